@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/nexus-im/nexus/ratelimit"
 	"github.com/nexus-im/nexus/store/session"
+	"github.com/nexus-im/nexus/store/ticket"
 
 	"github.com/gorilla/websocket"
 )
@@ -21,8 +25,17 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// How often an open connection extends its session when sliding
+	// expiry is enabled.
+	sessionSlideInterval = 15 * time.Minute
+
+	// Outbound frames buffered per connection before it is considered too
+	// slow and dropped.
+	sendBufferSize = 256
+
+	// Maximum message size allowed from peer. Large enough for a
+	// send_message envelope carrying maxContentLength multi-byte characters.
+	maxMessageSize = 16 * 1024
 )
 
 var upgrader = websocket.Upgrader{
@@ -43,6 +56,20 @@ type Client struct {
 
 	// Buffered channel of outbound messages.
 	send chan []byte
+
+	// The authenticated user this connection belongs to.
+	userID string
+
+	// The session the connection was opened with. Revoking the session
+	// closes the connection.
+	sessionID string
+
+	// Throttles typing events from this connection.
+	typingLimiter ratelimit.Limiter
+
+	// Whether the user reported this connection as idle. Owned by the hub's
+	// run loop.
+	away bool
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -77,9 +104,7 @@ func (c *Client) readPump() {
 			}
 			break
 		}
-		// For now, simply broadcast the raw message.
-		// Later we will parse JSON and handle events.
-		c.hub.broadcast <- message
+		c.hub.dispatcher.dispatch(c, message)
 	}
 }
 
@@ -96,6 +121,14 @@ func (c *Client) writePump() {
 			log.Printf("error closing connection: %v", err)
 		}
 	}()
+
+	// A nil channel never fires, disabling sliding expiry.
+	var slide <-chan time.Time
+	if *slidingSessions {
+		slideTicker := time.NewTicker(sessionSlideInterval)
+		defer slideTicker.Stop()
+		slide = slideTicker.C
+	}
 	for {
 		select {
 		case message, ok := <-c.send:
@@ -111,27 +144,12 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			if _, err := w.Write(message); err != nil {
+			// Each event is a standalone JSON document, so write one per
+			// frame rather than coalescing queued messages.
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				log.Printf("error writing message: %v", err)
 				return
 			}
-
-			// Add queued chat messages to the current websocket message.
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				if _, err := w.Write(<-c.send); err != nil {
-					log.Printf("error writing queued message: %v", err)
-					return
-				}
-			}
-
-			if err := w.Close(); err != nil {
-				return
-			}
 		case <-ticker.C:
 			if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
 				log.Printf("error setting write deadline: %v", err)
@@ -140,28 +158,67 @@ func (c *Client) writePump() {
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+		case <-slide:
+			if err := sessionStore.Extend(context.Background(), c.sessionID, time.Now().Add(sessionTTL), *refreshTTL); err != nil {
+				log.Printf("error extending session %s: %v", c.sessionID, err)
+			}
+		}
+	}
+}
+
+var errMissingWsCredentials = errors.New("missing ticket")
+
+// wsSession resolves the session for a WebSocket handshake from a one-time
+// connect ticket or, when -allow-query-token is set, from a session token in
+// the query string.
+func wsSession(r *http.Request) (*session.Session, error) {
+	query := r.URL.Query()
+
+	if value := query.Get("ticket"); value != "" {
+		t, err := ticketStore.Consume(r.Context(), value)
+		if err != nil {
+			return nil, err
 		}
+		return sessionStore.GetByID(r.Context(), t.SessionID)
+	}
+
+	if token := query.Get("token"); token != "" && *allowQueryToken {
+		return sessionStore.GetByToken(r.Context(), token)
 	}
+
+	return nil, errMissingWsCredentials
 }
 
 // serveWs handles websocket requests from the peer.
 func serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	tokenString := r.URL.Query().Get("token")
-	if tokenString == "" {
-		http.Error(w, "Unauthorized: missing token", http.StatusUnauthorized)
+	sess, err := wsSession(r)
+	if err != nil {
+		if err == errMissingWsCredentials {
+			http.Error(w, "Unauthorized: missing ticket", http.StatusUnauthorized)
+			return
+		}
+		if !errors.Is(err, ticket.ErrTicketNotFound) && !errors.Is(err, session.ErrSessionExpired) && !errors.Is(err, session.ErrSessionNotFound) {
+			log.Printf("error resolving websocket session: %v", err)
+		}
+		http.Error(w, "Unauthorized: invalid ticket or token", http.StatusUnauthorized)
 		return
 	}
 
-	sess, err := sessionStore.GetByToken(r.Context(), tokenString)
-	if err != nil {
-		if errors.Is(err, session.ErrSessionExpired) || errors.Is(err, session.ErrSessionNotFound) {
-			http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
+	var (
+		since  int64
+		resume bool
+	)
+	if v := r.URL.Query().Get("since"); v != "" {
+		since, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || since < 0 {
+			http.Error(w, "since must be a non-negative sequence number", http.StatusBadRequest)
 			return
 		}
-		http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
-		return
+		resume = true
 	}
 
+	touchSession(r, sess)
+
 	// Upgrade initial GET request to a websocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -175,9 +232,22 @@ func serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("Client connected: %s (%s)", username, sess.UserID)
 
-	// Register new client
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256)}
-	client.hub.register <- client
+	// Register new client, replaying missed events first if asked to.
+	client := &Client{
+		hub:       hub,
+		conn:      conn,
+		userID:    sess.UserID,
+		sessionID: sess.ID,
+
+		typingLimiter: newTypingLimiter(),
+	}
+	if err := hub.connect(r.Context(), client, since, resume); err != nil {
+		log.Printf("error replaying events for %s: %v", sess.UserID, err)
+		if err := conn.Close(); err != nil {
+			log.Printf("error closing connection: %v", err)
+		}
+		return
+	}
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
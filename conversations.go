@@ -0,0 +1,607 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nexus-im/nexus/store/conversation"
+	"github.com/nexus-im/nexus/store/user"
+)
+
+// handleConversations serves /api/conversations, dispatching on method.
+func handleConversations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleListConversations(w, r)
+	case http.MethodPost:
+		handleCreateConversation(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Limits on group metadata, matching the conversations table columns.
+const (
+	maxNameLength      = 100
+	maxTopicLength     = 500
+	maxAvatarURLLength = 2048
+)
+
+var (
+	errNameTooLong     = errors.New("name exceeds 100 characters")
+	errTopicTooLong    = errors.New("topic exceeds 500 characters")
+	errInvalidAvatar   = errors.New("avatar_url must be an absolute http(s) URL")
+	errNothingToUpdate = errors.New("at least one of name, topic or avatar_url is required")
+)
+
+// validateMetadata checks the set fields of a metadata update.
+func validateMetadata(u conversation.MetadataUpdate) error {
+	if u.Name != nil && utf8.RuneCountInString(*u.Name) > maxNameLength {
+		return errNameTooLong
+	}
+	if u.Topic != nil && utf8.RuneCountInString(*u.Topic) > maxTopicLength {
+		return errTopicTooLong
+	}
+	if u.AvatarURL != nil && *u.AvatarURL != "" {
+		if len(*u.AvatarURL) > maxAvatarURLLength {
+			return errInvalidAvatar
+		}
+		parsed, err := url.Parse(*u.AvatarURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errInvalidAvatar
+		}
+	}
+	return nil
+}
+
+// handleListConversations returns the caller's inbox: every conversation they
+// belong to with members, last message and unread count.
+func handleListConversations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	summaries, err := conversationStore.ListForUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing conversations: %v", err)
+		http.Error(w, "Failed to load conversations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"conversations": summaries,
+	})
+}
+
+type systemNotificationPayload struct {
+	ConversationID string    `json:"conversation_id"`
+	Event          string    `json:"event"`
+	ActorID        string    `json:"actor_id"`
+	UserIDs        []string  `json:"user_ids"`
+	Role           string    `json:"role,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// notifyConversation sends a system_notification to the current members of a
+// conversation plus any extra recipients (such as a user who was just
+// removed).
+func notifyConversation(ctx context.Context, hub *Hub, n systemNotificationPayload, extra ...string) {
+	members, err := conversationStore.ListMemberIDs(ctx, n.ConversationID)
+	if err != nil {
+		log.Printf("Error listing members of %s: %v", n.ConversationID, err)
+		return
+	}
+	if err := hub.publish(ctx, append(members, extra...), eventSystemNotification, n); err != nil {
+		log.Printf("Error sending system notification: %v", err)
+	}
+}
+
+// loadGroupForMember resolves the {id} path value to a group conversation the
+// caller belongs to, along with the caller's membership. It writes an error
+// response and returns nil when the lookup fails.
+func loadGroupForMember(w http.ResponseWriter, r *http.Request, userID string) (*conversation.Conversation, *conversation.Member) {
+	convo, err := conversationStore.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if err == conversation.ErrConversationNotFound {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return nil, nil
+		}
+		log.Printf("Error loading conversation: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, nil
+	}
+
+	member, err := conversationStore.GetMember(r.Context(), convo.ID, userID)
+	if err != nil {
+		if err == conversation.ErrNotMember {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return nil, nil
+		}
+		log.Printf("Error checking membership: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, nil
+	}
+
+	if convo.Type != conversation.TypeGroup {
+		http.Error(w, "Only group conversations can be managed", http.StatusBadRequest)
+		return nil, nil
+	}
+
+	return convo, member
+}
+
+// requirePermission writes 403 and returns false unless member's role grants
+// p. Every group-mutating endpoint goes through it.
+func requirePermission(w http.ResponseWriter, member *conversation.Member, p conversation.Permission) bool {
+	if member.Role.Can(p) {
+		return true
+	}
+	http.Error(w, "Insufficient group permissions", http.StatusForbidden)
+	return false
+}
+
+// handleConversation serves /api/conversations/{id}, dispatching on method.
+func handleConversation(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPatch:
+		handleUpdateConversation(hub, w, r)
+	case http.MethodDelete:
+		handleDeleteConversation(hub, w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type conversationUpdatedPayload struct {
+	ConversationID string    `json:"conversation_id"`
+	Name           string    `json:"name"`
+	Topic          string    `json:"topic"`
+	AvatarURL      string    `json:"avatar_url"`
+	UpdatedBy      string    `json:"updated_by"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// handleUpdateConversation applies a partial metadata update to a group and
+// broadcasts conversation_updated to its members.
+func handleUpdateConversation(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name      *string `json:"name"`
+		Topic     *string `json:"topic"`
+		AvatarURL *string `json:"avatar_url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	update := conversation.MetadataUpdate{Name: req.Name, Topic: req.Topic, AvatarURL: req.AvatarURL}
+	if update.Name == nil && update.Topic == nil && update.AvatarURL == nil {
+		http.Error(w, errNothingToUpdate.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateMetadata(update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	convo, member := loadGroupForMember(w, r, userID)
+	if convo == nil {
+		return
+	}
+	if !requirePermission(w, member, conversation.PermRename) {
+		return
+	}
+
+	updated, err := conversationStore.UpdateMetadata(r.Context(), convo.ID, update)
+	if err != nil {
+		if err == conversation.ErrConversationNotFound {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error updating conversation: %v", err)
+		http.Error(w, "Failed to update conversation", http.StatusInternalServerError)
+		return
+	}
+
+	members, err := conversationStore.ListMemberIDs(r.Context(), convo.ID)
+	if err != nil {
+		log.Printf("Error listing members of %s: %v", convo.ID, err)
+	} else if err := hub.publish(r.Context(), members, eventConversationUpdated, conversationUpdatedPayload{
+		ConversationID: updated.ID,
+		Name:           updated.Name,
+		Topic:          updated.Topic,
+		AvatarURL:      updated.AvatarURL,
+		UpdatedBy:      userID,
+		UpdatedAt:      time.Now().UTC(),
+	}); err != nil {
+		log.Printf("Error sending conversation_updated: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(updated)
+}
+
+// handleDeleteConversation deletes a group along with its messages.
+func handleDeleteConversation(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	convo, member := loadGroupForMember(w, r, userID)
+	if convo == nil {
+		return
+	}
+	if !requirePermission(w, member, conversation.PermDelete) {
+		return
+	}
+
+	// Collect recipients before the membership rows cascade away.
+	members, err := conversationStore.ListMemberIDs(r.Context(), convo.ID)
+	if err != nil {
+		log.Printf("Error listing members: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := conversationStore.DeleteConversation(r.Context(), convo.ID); err != nil {
+		log.Printf("Error deleting conversation: %v", err)
+		http.Error(w, "Failed to delete conversation", http.StatusInternalServerError)
+		return
+	}
+
+	if err := hub.publish(r.Context(), members, eventSystemNotification, systemNotificationPayload{
+		ConversationID: convo.ID,
+		Event:          notifyConversationDeleted,
+		ActorID:        userID,
+		Timestamp:      time.Now().UTC(),
+	}); err != nil {
+		log.Printf("Error sending system notification: %v", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAddMembers serves POST /api/conversations/{id}/members.
+func handleAddMembers(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		UserIDs []string `json:"user_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.UserIDs) == 0 {
+		http.Error(w, "user_ids is required", http.StatusBadRequest)
+		return
+	}
+	for _, id := range req.UserIDs {
+		if !isUUID(id) {
+			http.Error(w, "Unknown user: "+id, http.StatusBadRequest)
+			return
+		}
+	}
+
+	convo, member := loadGroupForMember(w, r, userID)
+	if convo == nil {
+		return
+	}
+	if !requirePermission(w, member, conversation.PermAddMembers) {
+		return
+	}
+
+	for _, id := range req.UserIDs {
+		if _, err := userStore.GetByID(r.Context(), id); err != nil {
+			if err == user.ErrUserNotFound {
+				http.Error(w, "Unknown user: "+id, http.StatusBadRequest)
+				return
+			}
+			log.Printf("Error loading user: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	added, err := conversationStore.AddMembers(r.Context(), convo.ID, req.UserIDs)
+	if err != nil {
+		log.Printf("Error adding members: %v", err)
+		http.Error(w, "Failed to add members", http.StatusInternalServerError)
+		return
+	}
+
+	if len(added) > 0 {
+		notifyConversation(r.Context(), hub, systemNotificationPayload{
+			ConversationID: convo.ID,
+			Event:          notifyMembersAdded,
+			ActorID:        userID,
+			UserIDs:        added,
+			Timestamp:      time.Now().UTC(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"added": added,
+	})
+}
+
+// handleRemoveMember serves DELETE /api/conversations/{id}/members/{userID}.
+// Removing yourself is equivalent to leaving; otherwise the caller must hold
+// PermRemoveMembers and outrank the target.
+func handleRemoveMember(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	convo, member := loadGroupForMember(w, r, userID)
+	if convo == nil {
+		return
+	}
+
+	targetID := r.PathValue("userID")
+	if targetID == userID {
+		leaveConversation(hub, w, r, convo, member)
+		return
+	}
+
+	if !requirePermission(w, member, conversation.PermRemoveMembers) {
+		return
+	}
+
+	target, err := conversationStore.GetMember(r.Context(), convo.ID, targetID)
+	if err != nil {
+		if err == conversation.ErrNotMember {
+			http.Error(w, "User is not a member", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error loading member: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !member.Role.Outranks(target.Role) {
+		http.Error(w, "Insufficient group permissions", http.StatusForbidden)
+		return
+	}
+
+	if err := conversationStore.RemoveMember(r.Context(), convo.ID, targetID); err != nil {
+		if err == conversation.ErrNotMember {
+			http.Error(w, "User is not a member", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error removing member: %v", err)
+		http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+		return
+	}
+
+	notifyConversation(r.Context(), hub, systemNotificationPayload{
+		ConversationID: convo.ID,
+		Event:          notifyMemberRemoved,
+		ActorID:        userID,
+		UserIDs:        []string{targetID},
+		Timestamp:      time.Now().UTC(),
+	}, targetID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleLeaveConversation serves POST /api/conversations/{id}/leave.
+func handleLeaveConversation(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	convo, member := loadGroupForMember(w, r, userID)
+	if convo == nil {
+		return
+	}
+
+	leaveConversation(hub, w, r, convo, member)
+}
+
+// leaveConversation removes the caller from convo. Owners must hand over
+// ownership first so a group is never left without one.
+func leaveConversation(hub *Hub, w http.ResponseWriter, r *http.Request, convo *conversation.Conversation, member *conversation.Member) {
+	if member.Role == conversation.RoleOwner {
+		http.Error(w, "Transfer ownership before leaving the group", http.StatusConflict)
+		return
+	}
+
+	if err := conversationStore.RemoveMember(r.Context(), convo.ID, member.UserID); err != nil {
+		if err == conversation.ErrNotMember {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error leaving conversation: %v", err)
+		http.Error(w, "Failed to leave conversation", http.StatusInternalServerError)
+		return
+	}
+
+	notifyConversation(r.Context(), hub, systemNotificationPayload{
+		ConversationID: convo.ID,
+		Event:          notifyMemberLeft,
+		ActorID:        member.UserID,
+		UserIDs:        []string{member.UserID},
+		Timestamp:      time.Now().UTC(),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSetMemberRole serves PUT /api/conversations/{id}/members/{userID}/role,
+// promoting a member to admin or demoting an admin to member.
+func handleSetMemberRole(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Role conversation.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Role != conversation.RoleAdmin && req.Role != conversation.RoleMember {
+		http.Error(w, "role must be admin or member", http.StatusBadRequest)
+		return
+	}
+
+	convo, member := loadGroupForMember(w, r, userID)
+	if convo == nil {
+		return
+	}
+	if !requirePermission(w, member, conversation.PermManageRoles) {
+		return
+	}
+
+	targetID := r.PathValue("userID")
+	if targetID == userID {
+		http.Error(w, "Use ownership transfer to change your own role", http.StatusBadRequest)
+		return
+	}
+
+	if err := conversationStore.SetRole(r.Context(), convo.ID, targetID, req.Role); err != nil {
+		if err == conversation.ErrNotMember {
+			http.Error(w, "User is not a member", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error setting role: %v", err)
+		http.Error(w, "Failed to set role", http.StatusInternalServerError)
+		return
+	}
+
+	notifyConversation(r.Context(), hub, systemNotificationPayload{
+		ConversationID: convo.ID,
+		Event:          notifyRoleChanged,
+		ActorID:        userID,
+		UserIDs:        []string{targetID},
+		Role:           string(req.Role),
+		Timestamp:      time.Now().UTC(),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTransferOwnership serves POST /api/conversations/{id}/owner. The
+// current owner becomes an admin.
+func handleTransferOwnership(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	convo, member := loadGroupForMember(w, r, userID)
+	if convo == nil {
+		return
+	}
+	if member.Role != conversation.RoleOwner {
+		http.Error(w, "Only the owner can transfer ownership", http.StatusForbidden)
+		return
+	}
+	if req.UserID == userID {
+		http.Error(w, "You already own this group", http.StatusBadRequest)
+		return
+	}
+
+	if err := conversationStore.TransferOwnership(r.Context(), convo.ID, userID, req.UserID); err != nil {
+		if err == conversation.ErrNotMember {
+			http.Error(w, "User is not a member", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error transferring ownership: %v", err)
+		http.Error(w, "Failed to transfer ownership", http.StatusInternalServerError)
+		return
+	}
+
+	notifyConversation(r.Context(), hub, systemNotificationPayload{
+		ConversationID: convo.ID,
+		Event:          notifyOwnershipTransferred,
+		ActorID:        userID,
+		UserIDs:        []string{req.UserID},
+		Role:           string(conversation.RoleOwner),
+		Timestamp:      time.Now().UTC(),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nexus-im/nexus/store/conversation"
+	"github.com/nexus-im/nexus/store/message"
+)
+
+// Scopes of delete_message.
+const (
+	deleteForMe       = "me"
+	deleteForEveryone = "everyone"
+)
+
+var (
+	errInvalidDeleteScope = errors.New("scope must be me or everyone")
+	errNotDeleter         = errors.New("only the sender or a higher-ranked group admin can delete a message for everyone")
+	errDeleteWindowClosed = errors.New("message can no longer be deleted for everyone")
+	errMessageDeleted     = errors.New("message was deleted")
+)
+
+type deleteMessagePayload struct {
+	MessageID string `json:"message_id"`
+	Scope     string `json:"scope"`
+}
+
+type messageDeletedPayload struct {
+	MessageID      string    `json:"message_id"`
+	ConversationID string    `json:"conversation_id"`
+	Scope          string    `json:"scope"`
+	DeletedBy      string    `json:"deleted_by"`
+	DeletedAt      time.Time `json:"deleted_at"`
+}
+
+// deleteMessage deletes a message for userID alone or, if they sent it or
+// administer the group and outrank its sender, for everyone in the
+// conversation. Malformed IDs and messages in conversations userID does not
+// belong to are reported as not found.
+func deleteMessage(ctx context.Context, hub *Hub, userID, messageID, scope string) error {
+	if !isUUID(messageID) {
+		return message.ErrMessageNotFound
+	}
+	if scope != deleteForMe && scope != deleteForEveryone {
+		return errInvalidDeleteScope
+	}
+
+	msg, err := messageStore.GetByID(ctx, messageID)
+	if err != nil {
+		return err
+	}
+
+	member, err := conversationStore.GetMember(ctx, msg.ConversationID, userID)
+	if err == conversation.ErrNotMember {
+		return message.ErrMessageNotFound
+	} else if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deleted := &messageDeletedPayload{
+		MessageID:      msg.ID,
+		ConversationID: msg.ConversationID,
+		Scope:          scope,
+		DeletedBy:      userID,
+		DeletedAt:      now.UTC(),
+	}
+
+	if scope == deleteForMe {
+		if err := messageStore.Hide(ctx, msg.ID, userID, now); err != nil {
+			return err
+		}
+		// Only the user's own devices need to drop the message.
+		if err := hub.publish(ctx, []string{userID}, eventMessageDeleted, deleted); err != nil {
+			log.Printf("Error sending message_deleted: %v", err)
+		}
+		return nil
+	}
+
+	if msg.DeletedAt != nil {
+		return errMessageDeleted
+	}
+	// In a P2P conversation everyone is a plain member, so only the sender
+	// qualifies.
+	if msg.SenderID != userID {
+		if !member.Role.Can(conversation.PermDeleteMessages) {
+			return errNotDeleter
+		}
+		// Like removal, moderation only reaches lower ranks. A sender who
+		// has since left no longer holds a role.
+		author, err := conversationStore.GetMember(ctx, msg.ConversationID, msg.SenderID)
+		if err == nil && !member.Role.Outranks(author.Role) {
+			return errNotDeleter
+		} else if err != nil && err != conversation.ErrNotMember {
+			return err
+		}
+	}
+	if now.Sub(msg.CreatedAt) > *deleteWindow {
+		return errDeleteWindowClosed
+	}
+
+	if _, err := messageStore.Delete(ctx, msg.ID, userID, now); err != nil {
+		if err == message.ErrMessageNotFound {
+			// Deleted concurrently by someone else.
+			return errMessageDeleted
+		}
+		return err
+	}
+
+	members, err := conversationStore.ListMemberIDs(ctx, msg.ConversationID)
+	if err != nil {
+		log.Printf("Error listing members of %s: %v", msg.ConversationID, err)
+		return nil
+	}
+	if err := hub.publish(ctx, members, eventMessageDeleted, deleted); err != nil {
+		log.Printf("Error sending message_deleted: %v", err)
+	}
+	return nil
+}
+
+func handleDeleteMessage(ctx context.Context, c *Client, raw json.RawMessage) error {
+	var p deleteMessagePayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return invalidPayload("malformed delete_message payload")
+	}
+	if p.MessageID == "" {
+		return invalidPayload("message_id is required")
+	}
+
+	err := deleteMessage(ctx, c.hub, c.userID, p.MessageID, p.Scope)
+	switch err {
+	case nil:
+		return nil
+	case errInvalidDeleteScope, errMessageDeleted, message.ErrMessageNotFound:
+		return invalidPayload(err.Error())
+	case errNotDeleter, errDeleteWindowClosed:
+		return unauthorized(err.Error())
+	default:
+		return err
+	}
+}
+
+// handleDeleteMessageRequest serves DELETE /api/messages/{id}?scope=me|everyone.
+// The scope defaults to me.
+func handleDeleteMessageRequest(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	scope := r.URL.Query().Get("scope")
+	if scope == "" {
+		scope = deleteForMe
+	}
+
+	err = deleteMessage(r.Context(), hub, userID, r.PathValue("id"), scope)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errInvalidDeleteScope:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case message.ErrMessageNotFound:
+		http.Error(w, "Message not found", http.StatusNotFound)
+	case errNotDeleter, errDeleteWindowClosed:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errMessageDeleted:
+		http.Error(w, "Message already deleted", http.StatusConflict)
+	default:
+		log.Printf("Error deleting message: %v", err)
+		http.Error(w, "Failed to delete message", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nexus-im/nexus/store/message"
+)
+
+var (
+	errNotSender        = errors.New("only the sender can edit a message")
+	errEditWindowClosed = errors.New("message can no longer be edited")
+)
+
+type editMessagePayload struct {
+	MessageID string `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+type messageEditedPayload struct {
+	MessageID      string    `json:"message_id"`
+	ConversationID string    `json:"conversation_id"`
+	SenderID       string    `json:"sender_id"`
+	Content        string    `json:"content"`
+	SentAt         time.Time `json:"sent_at"`
+	EditedAt       time.Time `json:"edited_at"`
+}
+
+// editMessage lets userID replace the content of a message they sent, within
+// the edit window, and tells the conversation's members. Messages in
+// conversations userID does not belong to are reported as not found.
+func editMessage(ctx context.Context, hub *Hub, userID, messageID, content string) (*message.Message, error) {
+	if !isUUID(messageID) {
+		return nil, message.ErrMessageNotFound
+	}
+	if err := validateContent(content); err != nil {
+		return nil, err
+	}
+
+	msg, err := messageStore.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := conversationStore.ListMemberIDs(ctx, msg.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !containsID(members, userID) {
+		return nil, message.ErrMessageNotFound
+	}
+	if msg.SenderID != userID {
+		return nil, errNotSender
+	}
+	if msg.DeletedAt != nil {
+		return nil, errMessageDeleted
+	}
+
+	now := time.Now()
+	if now.Sub(msg.CreatedAt) > *editWindow {
+		return nil, errEditWindowClosed
+	}
+	if content == msg.Content {
+		return msg, nil
+	}
+
+	msg, err = messageStore.Edit(ctx, messageID, content, now)
+	if err == message.ErrMessageNotFound {
+		// Deleted since it was loaded.
+		return nil, errMessageDeleted
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := hub.publish(ctx, members, eventMessageEdited, &messageEditedPayload{
+		MessageID:      msg.ID,
+		ConversationID: msg.ConversationID,
+		SenderID:       msg.SenderID,
+		Content:        msg.Content,
+		SentAt:         msg.CreatedAt.UTC(),
+		EditedAt:       msg.EditedAt.UTC(),
+	}); err != nil {
+		log.Printf("Error sending message_edited: %v", err)
+	}
+
+	return msg, nil
+}
+
+func handleEditMessage(ctx context.Context, c *Client, raw json.RawMessage) error {
+	var p editMessagePayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return invalidPayload("malformed edit_message payload")
+	}
+	if p.MessageID == "" {
+		return invalidPayload("message_id is required")
+	}
+
+	_, err := editMessage(ctx, c.hub, c.userID, p.MessageID, p.Content)
+	switch err {
+	case nil:
+		return nil
+	case errEmptyContent, errContentTooLong, errMessageDeleted, message.ErrMessageNotFound:
+		return invalidPayload(err.Error())
+	case errNotSender, errEditWindowClosed:
+		return unauthorized(err.Error())
+	default:
+		return err
+	}
+}
+
+// handleEditMessageRequest serves PATCH /api/messages/{id}.
+func handleEditMessageRequest(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := editMessage(r.Context(), hub, userID, r.PathValue("id"), req.Content)
+	switch err {
+	case nil:
+	case errEmptyContent, errContentTooLong:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case message.ErrMessageNotFound:
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	case errNotSender, errEditWindowClosed:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errMessageDeleted:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		log.Printf("Error editing message: %v", err)
+		http.Error(w, "Failed to edit message", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(msg)
+}
+
+// handleListRevisions serves GET /api/messages/{id}/revisions, returning the
+// superseded versions of a message to members of its conversation.
+func handleListRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := r.PathValue("id")
+	if !isUUID(messageID) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	msg, err := messageStore.GetByID(r.Context(), messageID)
+	if err == message.ErrMessageNotFound {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error loading message: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ok, err := conversationStore.IsMember(r.Context(), msg.ConversationID, userID)
+	if err != nil {
+		log.Printf("Error checking membership: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	revisions, err := messageStore.ListRevisions(r.Context(), msg.ID)
+	if err != nil {
+		log.Printf("Error listing revisions: %v", err)
+		http.Error(w, "Failed to load revisions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"revisions": revisions,
+	})
+}
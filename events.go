@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// Event types exchanged over the WebSocket connection. See
+// doc/messaging_spec.md for payload definitions.
+const (
+	eventSendMessage      = "send_message"
+	eventMessageDelivered = "message_delivered"
+	eventError            = "error"
+
+	eventSystemNotification  = "system_notification"
+	eventConversationUpdated = "conversation_updated"
+	eventSessionRevoked      = "session_revoked"
+
+	// Typing indicators share their names in both directions: clients send
+	// them for themselves and receive them for other members.
+	eventTypingStart = "typing_start"
+	eventTypingStop  = "typing_stop"
+
+	eventSetPresence     = "set_presence"
+	eventPresenceChanged = "presence_changed"
+
+	eventMarkDelivered  = "mark_delivered"
+	eventMarkRead       = "mark_read"
+	eventReceiptUpdated = "receipt_updated"
+
+	eventEditMessage   = "edit_message"
+	eventMessageEdited = "message_edited"
+
+	eventDeleteMessage  = "delete_message"
+	eventMessageDeleted = "message_deleted"
+
+	// Sent on connect, after any replayed events.
+	eventReplayComplete = "replay_complete"
+	eventResyncRequired = "resync_required"
+)
+
+// Kinds of system_notification events.
+const (
+	notifyMembersAdded  = "members_added"
+	notifyMemberRemoved = "member_removed"
+	notifyMemberLeft    = "member_left"
+
+	notifyRoleChanged          = "role_changed"
+	notifyOwnershipTransferred = "ownership_transferred"
+	notifyConversationDeleted  = "conversation_deleted"
+)
+
+// Error codes carried in the payload of an error event.
+const (
+	codeInvalidPayload = "invalid_payload"
+	codeUnauthorized   = "unauthorized"
+	codeServerError    = "server_error"
+	codeRateLimited    = "rate_limited"
+)
+
+// envelope is the {type, payload} wrapper around every WebSocket frame.
+// Server events that are part of the user's persisted stream also carry
+// their sequence number.
+type envelope struct {
+	Type    string          `json:"type"`
+	Seq     int64           `json:"seq,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type errorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// handlerError is returned by an eventHandler to report a failure back to the
+// client that sent the event. Any other error is reported as server_error.
+type handlerError struct {
+	Code    string
+	Message string
+}
+
+func (e *handlerError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func invalidPayload(message string) error {
+	return &handlerError{Code: codeInvalidPayload, Message: message}
+}
+
+func unauthorized(message string) error {
+	return &handlerError{Code: codeUnauthorized, Message: message}
+}
+
+func rateLimited(message string) error {
+	return &handlerError{Code: codeRateLimited, Message: message}
+}
+
+// eventHandler handles a single inbound event from c.
+type eventHandler func(ctx context.Context, c *Client, payload json.RawMessage) error
+
+// dispatcher routes inbound frames to the handler registered for their type.
+type dispatcher struct {
+	handlers map[string]eventHandler
+}
+
+func newDispatcher() *dispatcher {
+	return &dispatcher{handlers: make(map[string]eventHandler)}
+}
+
+// register installs h as the handler for eventType, replacing any previous
+// handler.
+func (d *dispatcher) register(eventType string, h eventHandler) {
+	d.handlers[eventType] = h
+}
+
+// dispatch decodes frame and invokes the matching handler. Failures are sent
+// back to c as an error event and never reach other clients.
+func (d *dispatcher) dispatch(c *Client, frame []byte) {
+	var env envelope
+	if err := json.Unmarshal(frame, &env); err != nil || env.Type == "" {
+		c.hub.sendError(c, codeInvalidPayload, "malformed event envelope")
+		return
+	}
+
+	h, ok := d.handlers[env.Type]
+	if !ok {
+		c.hub.sendError(c, codeInvalidPayload, "unknown event type: "+env.Type)
+		return
+	}
+
+	err := h(context.Background(), c, env.Payload)
+	if err == nil {
+		return
+	}
+
+	var ee *handlerError
+	if errors.As(err, &ee) {
+		c.hub.sendError(c, ee.Code, ee.Message)
+		return
+	}
+	log.Printf("error handling %s from %s: %v", env.Type, c.userID, err)
+	c.hub.sendError(c, codeServerError, "internal server error")
+}
+
+// encodeEvent marshals payload into an envelope of the given type.
+func encodeEvent(eventType string, payload interface{}) ([]byte, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{Type: eventType, Payload: raw})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDispatchErrorCodes(t *testing.T) {
+	d := newDispatcher()
+	d.register("ok", func(ctx context.Context, c *Client, raw json.RawMessage) error {
+		return nil
+	})
+	d.register("invalid", func(ctx context.Context, c *Client, raw json.RawMessage) error {
+		return invalidPayload("bad field")
+	})
+	d.register("forbidden", func(ctx context.Context, c *Client, raw json.RawMessage) error {
+		return unauthorized("not a member")
+	})
+	d.register("limited", func(ctx context.Context, c *Client, raw json.RawMessage) error {
+		return rateLimited("slow down")
+	})
+	d.register("wrapped", func(ctx context.Context, c *Client, raw json.RawMessage) error {
+		return fmt.Errorf("checking membership: %w", unauthorized("not a member"))
+	})
+	d.register("broken", func(ctx context.Context, c *Client, raw json.RawMessage) error {
+		return errors.New("connection refused")
+	})
+
+	tests := []struct {
+		name        string
+		frame       string
+		wantCode    string
+		wantMessage string
+	}{
+		{"malformed json", `{"type":`, codeInvalidPayload, "malformed event envelope"},
+		{"missing type", `{"payload":{}}`, codeInvalidPayload, "malformed event envelope"},
+		{"unknown type", `{"type":"nope","payload":{}}`, codeInvalidPayload, "unknown event type: nope"},
+		{"invalid payload", `{"type":"invalid","payload":{}}`, codeInvalidPayload, "bad field"},
+		{"unauthorized", `{"type":"forbidden","payload":{}}`, codeUnauthorized, "not a member"},
+		{"rate limited", `{"type":"limited","payload":{}}`, codeRateLimited, "slow down"},
+		{"wrapped handler error", `{"type":"wrapped","payload":{}}`, codeUnauthorized, "not a member"},
+		{"other error", `{"type":"broken","payload":{}}`, codeServerError, "internal server error"},
+		{"success", `{"type":"ok","payload":{}}`, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Hub{deliver: make(chan *delivery, 1)}
+			c := &Client{hub: h, userID: "user-1"}
+
+			d.dispatch(c, []byte(tt.frame))
+
+			var got *delivery
+			select {
+			case got = <-h.deliver:
+			default:
+			}
+
+			if tt.wantCode == "" {
+				if got != nil {
+					t.Fatalf("expected no reply, got %s", got.message)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("expected an error event, got nothing")
+			}
+			if got.client != c {
+				t.Error("error event must go to the sending connection only")
+			}
+
+			var env envelope
+			if err := json.Unmarshal(got.message, &env); err != nil {
+				t.Fatalf("error event is not an envelope: %v", err)
+			}
+			var p errorPayload
+			if err := json.Unmarshal(env.Payload, &p); err != nil {
+				t.Fatalf("malformed error payload: %v", err)
+			}
+			if env.Type != eventError || p.Code != tt.wantCode || p.Message != tt.wantMessage {
+				t.Errorf("got %s %+v, want error %s %q", env.Type, p, tt.wantCode, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -11,3 +11,5 @@ require (
 )
 
 require github.com/lib/pq v1.10.9
+
+require golang.org/x/sys v0.40.0 // indirect
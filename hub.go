@@ -1,49 +1,215 @@
 package main
 
-// Hub maintains the set of active clients and broadcasts messages to the
-// clients.
+import (
+	"log"
+)
+
+// Hub maintains the set of active clients and routes messages to the
+// clients of each conversation's members.
 type Hub struct {
-	// Registered clients.
-	clients map[*Client]bool
+	// Registered clients, keyed by the ID of the user they authenticated as.
+	// A user may hold several connections at once.
+	clients map[string]map[*Client]bool
+
+	// Outbound messages addressed to specific users.
+	deliver chan *delivery
 
-	// Inbound messages from the clients.
-	broadcast chan []byte
+	// Orders each user's sequenced events and replays; see publish.
+	streams streamLocks
 
 	// Register requests from the clients.
 	register chan *Client
 
 	// Unregister requests from clients.
 	unregister chan *Client
+
+	// Session IDs whose connections must be closed.
+	revoke chan []string
+
+	// Connections going idle or becoming active again.
+	setAway chan awayChange
+
+	// Requests for the current presence of users.
+	presenceQuery chan *presenceQuery
+
+	// Last announced status of every user who is not offline.
+	status map[string]string
+
+	// Announces presence changes outside the run loop.
+	presence *presenceNotifier
+
+	// Handlers for inbound client events.
+	dispatcher *dispatcher
+
+	// Who is currently typing where. Not persisted.
+	typing *typingTracker
+}
+
+// delivery is an encoded message addressed either to every connection of a
+// set of users or, when client is set, to that single connection.
+type delivery struct {
+	userIDs []string
+	client  *Client
+	message []byte
 }
 
 func newHub() *Hub {
-	return &Hub{
-		broadcast:  make(chan []byte),
+	h := &Hub{
+		deliver:    make(chan *delivery),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
+		revoke:     make(chan []string),
+		clients:    make(map[string]map[*Client]bool),
+		dispatcher: newDispatcher(),
+		typing:     newTypingTracker(),
+
+		setAway:       make(chan awayChange),
+		presenceQuery: make(chan *presenceQuery),
+		status:        make(map[string]string),
 	}
+	h.presence = newPresenceNotifier(h)
+	h.dispatcher.register(eventSendMessage, handleSendMessage)
+	h.dispatcher.register(eventTypingStart, handleTypingStart)
+	h.dispatcher.register(eventTypingStop, handleTypingStop)
+	h.dispatcher.register(eventSetPresence, handleSetPresence)
+	h.dispatcher.register(eventMarkDelivered, handleMarkDelivered)
+	h.dispatcher.register(eventMarkRead, handleMarkRead)
+	h.dispatcher.register(eventEditMessage, handleEditMessage)
+	h.dispatcher.register(eventDeleteMessage, handleDeleteMessage)
+	return h
 }
 
 func (h *Hub) run() {
+	go h.presence.run()
+
 	for {
 		select {
 		case client := <-h.register:
-			h.clients[client] = true
+			conns, ok := h.clients[client.userID]
+			if !ok {
+				conns = make(map[*Client]bool)
+				h.clients[client.userID] = conns
+			}
+			conns[client] = true
+			h.updatePresence(client.userID)
+		case change := <-h.setAway:
+			if h.clients[change.client.userID][change.client] {
+				change.client.away = change.away
+				h.updatePresence(change.client.userID)
+			}
+		case q := <-h.presenceQuery:
+			statuses := make(map[string]string, len(q.userIDs))
+			for _, id := range q.userIDs {
+				statuses[id] = h.userPresence(id)
+			}
+			q.reply <- statuses
 		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+			h.removeClient(client)
+		case sessionIDs := <-h.revoke:
+			h.closeSessions(sessionIDs)
+		case d := <-h.deliver:
+			if d.client != nil {
+				if h.clients[d.client.userID][d.client] {
+					h.trySend(d.client, d.message)
+				}
+				continue
+			}
+			for _, userID := range d.userIDs {
+				for client := range h.clients[userID] {
+					h.trySend(client, d.message)
+				}
 			}
-		case message := <-h.broadcast:
-			for client := range h.clients {
+		}
+	}
+}
+
+// closeSessions notifies and disconnects every client bound to one of the
+// given sessions. Queued messages, including the notice, are flushed by
+// writePump before it sends the close frame.
+func (h *Hub) closeSessions(sessionIDs []string) {
+	revoked := make(map[string]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		revoked[id] = true
+	}
+
+	notice, err := encodeEvent(eventSessionRevoked, struct{}{})
+	if err != nil {
+		log.Printf("error encoding session_revoked: %v", err)
+	}
+
+	for _, conns := range h.clients {
+		for client := range conns {
+			if !revoked[client.sessionID] {
+				continue
+			}
+			if notice != nil {
 				select {
-				case client.send <- message:
+				case client.send <- notice:
 				default:
-					close(client.send)
-					delete(h.clients, client)
 				}
 			}
+			h.removeClient(client)
 		}
 	}
 }
+
+// revokeSessions closes any live connections opened with the given sessions.
+func (h *Hub) revokeSessions(sessionIDs []string) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	h.revoke <- sessionIDs
+}
+
+// trySend queues message on client without blocking the hub, dropping the
+// client if its buffer is full.
+func (h *Hub) trySend(client *Client, message []byte) {
+	select {
+	case client.send <- message:
+	default:
+		h.removeClient(client)
+	}
+}
+
+// removeClient drops client from the registry and closes its send channel.
+// It is a no-op if the client was already removed.
+func (h *Hub) removeClient(client *Client) {
+	conns, ok := h.clients[client.userID]
+	if !ok || !conns[client] {
+		return
+	}
+	delete(conns, client)
+	if len(conns) == 0 {
+		delete(h.clients, client.userID)
+	}
+	close(client.send)
+	h.updatePresence(client.userID)
+}
+
+// sendToUsers encodes an event and delivers it to every connection of the
+// given users.
+func (h *Hub) sendToUsers(userIDs []string, eventType string, payload interface{}) error {
+	out, err := encodeEvent(eventType, payload)
+	if err != nil {
+		return err
+	}
+	h.deliver <- &delivery{userIDs: userIDs, message: out}
+	return nil
+}
+
+// sendToClient encodes an event and delivers it to a single connection.
+func (h *Hub) sendToClient(c *Client, eventType string, payload interface{}) error {
+	out, err := encodeEvent(eventType, payload)
+	if err != nil {
+		return err
+	}
+	h.deliver <- &delivery{client: c, message: out}
+	return nil
+}
+
+// sendError reports a failed event back to the client that sent it.
+func (h *Hub) sendError(c *Client, code, message string) {
+	if err := h.sendToClient(c, eventError, errorPayload{Code: code, Message: message}); err != nil {
+		log.Printf("error encoding error event: %v", err)
+	}
+}
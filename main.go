@@ -5,15 +5,26 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"expvar"
 	"flag"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/nexus-im/nexus/notify"
+	"github.com/nexus-im/nexus/passhash"
+	"github.com/nexus-im/nexus/policy"
+	"github.com/nexus-im/nexus/ratelimit"
 	"github.com/nexus-im/nexus/store/conversation"
+	"github.com/nexus-im/nexus/store/event"
+	"github.com/nexus-im/nexus/store/message"
 	"github.com/nexus-im/nexus/store/session"
+	"github.com/nexus-im/nexus/store/ticket"
 	"github.com/nexus-im/nexus/store/user"
 
 	"golang.org/x/crypto/bcrypt"
@@ -21,16 +32,55 @@ import (
 	_ "github.com/lib/pq"
 )
 
-var addr = flag.String("addr", ":8080", "http service address")
+var (
+	addr            = flag.String("addr", ":8080", "http service address")
+	refreshTTL      = flag.Duration("refresh-ttl", 30*24*time.Hour, "lifetime of a refresh token family; also caps sliding session expiry")
+	slidingSessions = flag.Bool("sliding-sessions", false, "keep sessions alive while a WebSocket connection stays open")
+	allowQueryToken = flag.Bool("allow-query-token", true, "accept session tokens in the /ws query string for clients that predate connect tickets")
+	debugAddr       = flag.String("debug-addr", "", "address of an internal listener serving /debug/vars (disabled when empty); keep it off public interfaces")
+	gcInterval      = flag.Duration("gc-interval", 10*time.Minute, "how often expired sessions, connect tickets, login challenges, password resets and old stream events are purged")
+	gcBatchSize     = flag.Int("gc-batch", 1000, "maximum rows deleted per statement by the sweeper")
+	lockoutAfter    = flag.Int("login-lockout-threshold", 10, "consecutive failed logins after which a username is temporarily locked (0 disables)")
+	lockoutDuration = flag.Duration("login-lockout-duration", 15*time.Minute, "how long a username stays locked after too many failed logins")
+	hashScheme      = flag.String("password-hash", "bcrypt", "password hashing scheme for new and upgraded hashes: bcrypt or argon2id")
+	bcryptCost      = flag.Int("bcrypt-cost", bcrypt.DefaultCost, "bcrypt cost factor")
+	argon2Time      = flag.Uint("argon2-time", uint(passhash.DefaultArgon2id.Time), "argon2id iterations")
+	argon2Memory    = flag.Uint("argon2-memory", uint(passhash.DefaultArgon2id.Memory), "argon2id memory in KiB")
+	argon2Threads   = flag.Uint("argon2-threads", uint(passhash.DefaultArgon2id.Threads), "argon2id parallelism")
+	passwordMinLen  = flag.Int("password-min-length", policy.DefaultPasswordPolicy.MinLength, "minimum number of characters in a new password")
+	passwordMaxLen  = flag.Int("password-max-length", policy.DefaultPasswordPolicy.MaxLength, "maximum length of a new password in bytes")
+	passwordClasses = flag.Int("password-min-classes", policy.DefaultPasswordPolicy.MinClasses, "character classes (lower, upper, digit, symbol) a new password must mix")
+	eventRetention  = flag.Duration("event-retention", 7*24*time.Hour, "how long per-user events are kept for reconnect catch-up")
+	editWindow      = flag.Duration("edit-window", 15*time.Minute, "how long after sending a message its sender may edit it")
+	deleteWindow    = flag.Duration("delete-window", 24*time.Hour, "how long after sending a message it may be deleted for everyone")
+	notifyFile      = flag.String("notify-file", "", "append user notifications such as password reset tokens to this file as JSON lines; password reset is disabled without it")
+)
 
 // Global instances (in a real app, use dependency injection)
 var (
 	userStore         user.Store
 	sessionStore      session.Store
 	conversationStore conversation.Store
+	messageStore      message.Store
+	ticketStore       ticket.Store
+	eventStore        event.Store
+
+	// Login attempts are throttled both per client IP and per username.
+	loginIPLimiter   ratelimit.Limiter
+	loginUserLimiter ratelimit.Limiter
+
+	notifier       notify.Notifier
+	passwordHasher passhash.Hasher
+	passwordPolicy policy.PasswordPolicy
 )
 
-const sessionTTL = 24 * time.Hour
+const (
+	sessionTTL = 24 * time.Hour
+
+	// sessionTouchInterval throttles last-used bookkeeping so that not every
+	// authenticated request costs a write.
+	sessionTouchInterval = time.Minute
+)
 
 func main() {
 	flag.Parse()
@@ -62,30 +112,165 @@ func main() {
 	userStore = user.NewSQLStore(db)
 	sessionStore = session.NewSQLStore(db)
 	conversationStore = conversation.NewSQLStore(db)
+	messageStore = message.NewSQLStore(db)
+	ticketStore = ticket.NewSQLStore(db)
+	eventStore = event.NewSQLStore(db)
+
+	switch *hashScheme {
+	case "bcrypt":
+		if *bcryptCost < bcrypt.MinCost || *bcryptCost > bcrypt.MaxCost {
+			log.Fatalf("bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		// Longer passwords would pass the policy and then fail to hash.
+		if *passwordMaxLen > passhash.BcryptMaxPasswordLength {
+			log.Fatalf("password-max-length must be at most %d with bcrypt", passhash.BcryptMaxPasswordLength)
+		}
+		passwordHasher = passhash.Bcrypt{Cost: *bcryptCost}
+	case "argon2id":
+		if *argon2Time < 1 || *argon2Threads < 1 || *argon2Threads > 255 {
+			log.Fatal("argon2-time and argon2-threads must be positive, argon2-threads at most 255")
+		}
+		params := passhash.DefaultArgon2id
+		params.Time = uint32(*argon2Time)
+		params.Memory = uint32(*argon2Memory)
+		params.Threads = uint8(*argon2Threads)
+		passwordHasher = params
+	default:
+		log.Fatalf("unknown password-hash %q", *hashScheme)
+	}
+
+	passwordPolicy = policy.PasswordPolicy{
+		MinLength:  *passwordMinLen,
+		MaxLength:  *passwordMaxLen,
+		MinClasses: *passwordClasses,
+	}
+
+	// Password reset stays disabled until tokens can be delivered somewhere
+	// other than the server log.
+	if *notifyFile != "" {
+		notifier = notify.NewFileNotifier(*notifyFile)
+	}
+
+	loginIPLimiter = ratelimit.NewMemoryLimiter(ratelimit.Config{
+		Rate:             1.0 / 6,
+		Burst:            20,
+		FreeFailures:     5,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 50,
+		LockoutDuration:  15 * time.Minute,
+		FailureWindow:    15 * time.Minute,
+	})
+	loginUserLimiter = ratelimit.NewMemoryLimiter(ratelimit.Config{
+		Rate:             1.0 / 12,
+		Burst:            10,
+		FreeFailures:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         30 * time.Second,
+		LockoutThreshold: *lockoutAfter,
+		LockoutDuration:  *lockoutDuration,
+		FailureWindow:    15 * time.Minute,
+	})
+
+	if *editWindow <= 0 || *deleteWindow <= 0 {
+		log.Fatal("edit-window and delete-window must be positive")
+	}
 
 	hub := newHub()
 	go hub.run()
 
+	if *gcInterval <= 0 || *gcBatchSize <= 0 || *eventRetention <= 0 {
+		log.Fatal("gc-interval, gc-batch and event-retention must be positive")
+	}
+	gc := &sweeper{interval: *gcInterval, batchSize: *gcBatchSize, eventRetention: *eventRetention}
+	go gc.run()
+
+	// Routes are registered on their own mux: importing expvar registers
+	// /debug/vars on the default one, which must not be public.
+	mux := http.NewServeMux()
+
 	// API Endpoints
-	http.HandleFunc("/api/register", handleRegister)
-	http.HandleFunc("/api/login", handleLogin)
-	http.HandleFunc("/api/conversations", handleCreateConversation)
+	mux.HandleFunc("/api/register", handleRegister)
+	mux.HandleFunc("/api/login", handleLogin)
+	mux.HandleFunc("/api/login/2fa", handleLoginTwoFactor)
+	mux.HandleFunc("/api/2fa/enroll", handleTwoFactorEnroll)
+	mux.HandleFunc("/api/2fa/verify", handleTwoFactorVerify)
+	mux.HandleFunc("/api/2fa/disable", handleTwoFactorDisable)
+	mux.HandleFunc("/api/password", func(w http.ResponseWriter, r *http.Request) {
+		handleChangePassword(hub, w, r)
+	})
+	mux.HandleFunc("/api/password/reset-request", handleRequestPasswordReset)
+	mux.HandleFunc("/api/password/reset", func(w http.ResponseWriter, r *http.Request) {
+		handleResetPassword(hub, w, r)
+	})
+	mux.HandleFunc("/api/token/refresh", func(w http.ResponseWriter, r *http.Request) {
+		handleRefreshToken(hub, w, r)
+	})
+	mux.HandleFunc("/api/ws-ticket", handleCreateWsTicket)
+	mux.HandleFunc("/api/logout", func(w http.ResponseWriter, r *http.Request) {
+		handleLogout(hub, w, r)
+	})
+	mux.HandleFunc("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		handleSessions(hub, w, r)
+	})
+	mux.HandleFunc("/api/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleRevokeSession(hub, w, r)
+	})
+	mux.HandleFunc("/api/presence", func(w http.ResponseWriter, r *http.Request) {
+		handlePresence(hub, w, r)
+	})
+	mux.HandleFunc("/api/conversations", handleConversations)
+	mux.HandleFunc("/api/conversations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleConversation(hub, w, r)
+	})
+	mux.HandleFunc("/api/conversations/{id}/messages", handleListMessages)
+	mux.HandleFunc("/api/conversations/{id}/receipts", handleListReceipts)
+	mux.HandleFunc("/api/messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleMessage(hub, w, r)
+	})
+	mux.HandleFunc("/api/messages/{id}/revisions", handleListRevisions)
+	mux.HandleFunc("/api/conversations/{id}/members", func(w http.ResponseWriter, r *http.Request) {
+		handleAddMembers(hub, w, r)
+	})
+	mux.HandleFunc("/api/conversations/{id}/members/{userID}", func(w http.ResponseWriter, r *http.Request) {
+		handleRemoveMember(hub, w, r)
+	})
+	mux.HandleFunc("/api/conversations/{id}/members/{userID}/role", func(w http.ResponseWriter, r *http.Request) {
+		handleSetMemberRole(hub, w, r)
+	})
+	mux.HandleFunc("/api/conversations/{id}/leave", func(w http.ResponseWriter, r *http.Request) {
+		handleLeaveConversation(hub, w, r)
+	})
+	mux.HandleFunc("/api/conversations/{id}/owner", func(w http.ResponseWriter, r *http.Request) {
+		handleTransferOwnership(hub, w, r)
+	})
 
 	// WebSocket Endpoint
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		serveWs(hub, w, r)
 	})
 
 	// Health Check
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		if _, err := w.Write([]byte("OK")); err != nil {
 			log.Printf("health check write error: %v", err)
 		}
 	})
 
+	if *debugAddr != "" {
+		debug := http.NewServeMux()
+		debug.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			log.Printf("Debug listener starting on %s", *debugAddr)
+			if err := http.ListenAndServe(*debugAddr, debug); err != nil {
+				log.Printf("debug listener: %v", err)
+			}
+		}()
+	}
+
 	log.Printf("Server starting on %s", *addr)
-	err = http.ListenAndServe(*addr, nil)
+	err = http.ListenAndServe(*addr, mux)
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
@@ -107,13 +292,13 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Username == "" || req.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+	if verr := policy.Merge(policy.ValidateUsername(req.Username), passwordPolicy.Validate(req.Password)); verr != nil {
+		writeValidationError(w, verr)
 		return
 	}
 
 	// Hash Password
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(req.Password)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -135,7 +320,7 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 	// I'll assume we need to provide an ID.
 	newUser := &user.User{
 		Username:     req.Username,
-		PasswordHash: string(hashedBytes),
+		PasswordHash: hashedPassword,
 		CreatedAt:    time.Now(),
 		LastSeen:     time.Now(),
 	}
@@ -174,9 +359,16 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ipKey := "ip:" + clientIP(r)
+	userKey := loginUserKey(req.Username)
+	if !allowLoginAttempt(w, r, ipKey, userKey) {
+		return
+	}
+
 	u, err := userStore.GetByUsername(r.Context(), req.Username)
 	if err != nil {
 		if err == user.ErrUserNotFound {
+			recordLoginFailure(r, ipKey, userKey)
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
@@ -184,23 +376,49 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)); err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	if !checkPassword(w, r, u, req.Password, ipKey, userKey) {
+		return
+	}
+	rehashPassword(r.Context(), u, req.Password)
+
+	if u.TOTPEnabled {
+		issueLoginChallenge(w, r, u)
 		return
 	}
 
+	// Only the username is forgiven on success; clearing the IP would let
+	// an attacker with one valid account keep guessing at others.
+	if err := loginUserLimiter.Reset(r.Context(), userKey); err != nil {
+		log.Printf("Error resetting login limiter: %v", err)
+	}
+
+	issueSession(w, r, u.ID)
+}
+
+// issueSession creates a session for userID and writes its tokens.
+func issueSession(w http.ResponseWriter, r *http.Request, userID string) {
 	token, err := generateSessionToken()
 	if err != nil {
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
+	refreshToken, err := generateSessionToken()
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
 
 	now := time.Now()
 	sess := &session.Session{
-		UserID:    u.ID,
-		Token:     token,
-		CreatedAt: now,
-		ExpiresAt: now.Add(sessionTTL),
+		UserID:           userID,
+		Token:            token,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(sessionTTL),
+		UserAgent:        r.UserAgent(),
+		IPAddress:        clientIP(r),
+		LastUsedAt:       now,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: now.Add(*refreshTTL),
 	}
 
 	if err := sessionStore.Create(r.Context(), sess); err != nil {
@@ -209,13 +427,76 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeSessionTokens(w, sess)
+}
+
+// loginUserKey returns the limiter key for a username. Usernames are
+// case-insensitive, so changing the case must not escape the limits.
+func loginUserKey(username string) string {
+	return "user:" + user.NormalizeUsername(username)
+}
+
+// resetUserKey is the limiter key for password reset requests for username.
+func resetUserKey(username string) string {
+	return "reset:" + user.NormalizeUsername(username)
+}
+
+// allowLoginAttempt checks the login limiters and writes a 429 with
+// Retry-After if either of them rejects the attempt.
+func allowLoginAttempt(w http.ResponseWriter, r *http.Request, ipKey, userKey string) bool {
+	for _, check := range []struct {
+		limiter ratelimit.Limiter
+		key     string
+	}{
+		{loginIPLimiter, ipKey},
+		{loginUserLimiter, userKey},
+	} {
+		wait, err := check.limiter.Allow(r.Context(), check.key)
+		if err != nil {
+			log.Printf("Error checking login limiter: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return false
+		}
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many login attempts", http.StatusTooManyRequests)
+			return false
+		}
+	}
+	return true
+}
+
+func recordLoginFailure(r *http.Request, ipKey, userKey string) {
+	if err := loginIPLimiter.RecordFailure(r.Context(), ipKey); err != nil {
+		log.Printf("Error recording login failure: %v", err)
+	}
+	if err := loginUserLimiter.RecordFailure(r.Context(), userKey); err != nil {
+		log.Printf("Error recording login failure: %v", err)
+	}
+}
+
+// writeValidationError reports policy violations as a structured 400.
+func writeValidationError(w http.ResponseWriter, verr *policy.Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      "validation_failed",
+		"violations": verr.Violations,
+	})
+}
+
+// writeSessionTokens writes the token response shared by login and refresh.
+func writeSessionTokens(w http.ResponseWriter, sess *session.Session) {
+	now := time.Now()
 	w.Header().Set("Content-Type", "application/json")
 	resp := map[string]interface{}{
-		"token":      token,
-		"expires_in": int(sessionTTL.Seconds()),
+		"token":              sess.Token,
+		"expires_in":         int(sess.ExpiresAt.Sub(now).Seconds()),
+		"refresh_token":      sess.RefreshToken,
+		"refresh_expires_in": int(sess.RefreshExpiresAt.Sub(now).Seconds()),
 	}
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		log.Printf("login response write error: %v", err)
+		log.Printf("token response write error: %v", err)
 	}
 }
 
@@ -235,6 +516,9 @@ func handleCreateConversation(w http.ResponseWriter, r *http.Request) {
 		Type      string   `json:"type"`
 		UserID    string   `json:"user_id"`
 		MemberIDs []string `json:"member_ids"`
+		Name      string   `json:"name"`
+		Topic     string   `json:"topic"`
+		AvatarURL string   `json:"avatar_url"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -295,6 +579,14 @@ func handleCreateConversation(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "member_ids is required for group conversations", http.StatusBadRequest)
 			return
 		}
+		if err := validateMetadata(conversation.MetadataUpdate{
+			Name:      &req.Name,
+			Topic:     &req.Topic,
+			AvatarURL: &req.AvatarURL,
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		memberSet := map[string]struct{}{userID: {}}
 		for _, id := range req.MemberIDs {
@@ -313,6 +605,9 @@ func handleCreateConversation(w http.ResponseWriter, r *http.Request) {
 			Type:      conversation.TypeGroup,
 			CreatedBy: userID,
 			CreatedAt: time.Now(),
+			Name:      req.Name,
+			Topic:     req.Topic,
+			AvatarURL: req.AvatarURL,
 		}
 		if err := conversationStore.CreateConversation(r.Context(), convo, members); err != nil {
 			http.Error(w, "Failed to create conversation", http.StatusInternalServerError)
@@ -333,6 +628,16 @@ func handleCreateConversation(w http.ResponseWriter, r *http.Request) {
 }
 
 func authenticateRequest(r *http.Request) (string, error) {
+	sess, err := authenticateSession(r)
+	if err != nil {
+		return "", err
+	}
+	return sess.UserID, nil
+}
+
+// authenticateSession resolves the session presented in the X-Session-Token
+// or Authorization: Bearer header.
+func authenticateSession(r *http.Request) (*session.Session, error) {
 	token := strings.TrimSpace(r.Header.Get("X-Session-Token"))
 	if token == "" {
 		authHeader := r.Header.Get("Authorization")
@@ -341,14 +646,40 @@ func authenticateRequest(r *http.Request) (string, error) {
 		}
 	}
 	if token == "" {
-		return "", session.ErrSessionNotFound
+		return nil, session.ErrSessionNotFound
 	}
 
 	sess, err := sessionStore.GetByToken(r.Context(), token)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return sess.UserID, nil
+	touchSession(r, sess)
+	return sess, nil
+}
+
+// touchSession records the client currently using sess. Writes are skipped
+// when nothing changed within sessionTouchInterval.
+func touchSession(r *http.Request, sess *session.Session) {
+	now := time.Now()
+	userAgent, ip := r.UserAgent(), clientIP(r)
+	if userAgent == sess.UserAgent && ip == sess.IPAddress && now.Sub(sess.LastUsedAt) < sessionTouchInterval {
+		return
+	}
+
+	if err := sessionStore.Touch(r.Context(), sess.ID, now, userAgent, ip); err != nil {
+		log.Printf("Error touching session: %v", err)
+		return
+	}
+	sess.LastUsedAt, sess.UserAgent, sess.IPAddress = now, userAgent, ip
+}
+
+// clientIP returns the address of the peer that sent r, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 func generateSessionToken() (string, error) {
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nexus-im/nexus/store/message"
+)
+
+const (
+	// maxContentLength is the maximum number of characters in a message body.
+	maxContentLength = 2000
+
+	// maxClientIDLength bounds the sender-generated de-duplication key.
+	maxClientIDLength = 100
+
+	// Page sizes for the message history endpoint.
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 100
+)
+
+var (
+	errEmptyContent    = errors.New("content is required")
+	errContentTooLong  = errors.New("content exceeds 2000 characters")
+	errMissingConvo    = errors.New("conversation_id is required")
+	errClientIDTooLong = errors.New("client_id exceeds 100 characters")
+	errClientIDReused  = errors.New("client_id was already used in another conversation")
+)
+
+type sendMessagePayload struct {
+	ConversationID string `json:"conversation_id"`
+	Content        string `json:"content"`
+	ClientID       string `json:"client_id,omitempty"`
+}
+
+type messageDeliveredPayload struct {
+	MessageID      string     `json:"message_id"`
+	ConversationID string     `json:"conversation_id"`
+	SenderID       string     `json:"sender_id"`
+	Content        string     `json:"content"`
+	SentAt         time.Time  `json:"sent_at"`
+	ClientID       string     `json:"client_id,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (p *sendMessagePayload) validate() error {
+	if p.ConversationID == "" {
+		return errMissingConvo
+	}
+	if err := validateContent(p.Content); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(p.ClientID) > maxClientIDLength {
+		return errClientIDTooLong
+	}
+	return nil
+}
+
+// validateContent applies the message body rules shared by sending and
+// editing.
+func validateContent(content string) error {
+	if content == "" {
+		return errEmptyContent
+	}
+	if utf8.RuneCountInString(content) > maxContentLength {
+		return errContentTooLong
+	}
+	return nil
+}
+
+// persistMessage stores a validated send_message payload on behalf of
+// senderID, returning the message_delivered payload for fan-out. If the
+// sender already sent a message with the same client_id, nothing is stored
+// and the original message is returned with replay set, unless it belongs
+// to another conversation, which is reported as errClientIDReused.
+func persistMessage(ctx context.Context, senderID string, p *sendMessagePayload) (delivered *messageDeliveredPayload, replay bool, err error) {
+	msg := &message.Message{
+		ConversationID: p.ConversationID,
+		SenderID:       senderID,
+		Content:        p.Content,
+		ClientID:       p.ClientID,
+	}
+	err = messageStore.Create(ctx, msg)
+	if err == message.ErrDuplicateClientID {
+		msg, err = messageStore.GetByClientID(ctx, senderID, p.ClientID)
+		if err == nil && msg.ConversationID != p.ConversationID {
+			err = errClientIDReused
+		}
+		replay = true
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return newMessageDelivered(msg), replay, nil
+}
+
+func newMessageDelivered(msg *message.Message) *messageDeliveredPayload {
+	var deletedAt *time.Time
+	if msg.DeletedAt != nil {
+		t := msg.DeletedAt.UTC()
+		deletedAt = &t
+	}
+	return &messageDeliveredPayload{
+		MessageID:      msg.ID,
+		ConversationID: msg.ConversationID,
+		SenderID:       msg.SenderID,
+		Content:        msg.Content,
+		SentAt:         msg.CreatedAt.UTC(),
+		ClientID:       msg.ClientID,
+		DeletedAt:      deletedAt,
+	}
+}
+
+// handleSendMessage persists a send_message event and fans the resulting
+// message_delivered event out to every member of the conversation.
+func handleSendMessage(ctx context.Context, c *Client, raw json.RawMessage) error {
+	var p sendMessagePayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return invalidPayload("malformed send_message payload")
+	}
+	if err := p.validate(); err != nil {
+		return invalidPayload(err.Error())
+	}
+
+	ok, err := conversationStore.IsMember(ctx, p.ConversationID, c.userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return unauthorized("not a member of this conversation")
+	}
+
+	delivered, replay, err := persistMessage(ctx, c.userID, &p)
+	if err == errClientIDReused {
+		return invalidPayload(err.Error())
+	} else if err != nil {
+		return err
+	}
+	if replay {
+		// A retry after a lost acknowledgement. The other members already
+		// have the message, so only the sender's own stream gets it again.
+		return c.hub.publish(ctx, []string{c.userID}, eventMessageDelivered, delivered)
+	}
+
+	// The message itself tells the others that the sender stopped typing.
+	c.hub.typing.stop(typingKey{conversationID: p.ConversationID, userID: c.userID})
+
+	members, err := conversationStore.ListMemberIDs(ctx, p.ConversationID)
+	if err != nil {
+		return err
+	}
+
+	// The message is stored, so reporting a failure now would only invite a
+	// duplicate. If the event could not be stored, publish has told the
+	// members to resync, which picks the message up.
+	if err := c.hub.publish(ctx, members, eventMessageDelivered, delivered); err != nil {
+		log.Printf("Error publishing message %s: %v", delivered.MessageID, err)
+	}
+	return nil
+}
+
+// handleListMessages serves GET /api/conversations/{id}/messages, returning
+// a page of history to members of the conversation.
+func handleListMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := message.ListOptions{
+		Before:   query.Get("before"),
+		After:    query.Get("after"),
+		Limit:    defaultHistoryLimit,
+		ViewerID: userID,
+	}
+	if opts.Before != "" && opts.After != "" {
+		http.Error(w, "Only one of before and after may be set", http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		opts.Limit = limit
+	}
+
+	cursor := opts.Before + opts.After
+	if cursor != "" && !isUUID(cursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	conversationID := r.PathValue("id")
+	ok, err := conversationStore.IsMember(r.Context(), conversationID, userID)
+	if err != nil {
+		log.Printf("Error checking membership: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	// A cursor from another conversation, or none at all, would silently
+	// yield an empty page.
+	if cursor != "" {
+		msg, err := messageStore.GetByID(r.Context(), cursor)
+		if err != nil && err != message.ErrMessageNotFound {
+			log.Printf("Error loading cursor message: %v", err)
+			http.Error(w, "Failed to load messages", http.StatusInternalServerError)
+			return
+		}
+		if err == message.ErrMessageNotFound || msg.ConversationID != conversationID {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Fetch one extra row to learn whether another page exists.
+	requested := opts.Limit
+	opts.Limit++
+	msgs, err := messageStore.ListByConversation(r.Context(), conversationID, opts)
+	if err != nil {
+		log.Printf("Error listing messages: %v", err)
+		http.Error(w, "Failed to load messages", http.StatusInternalServerError)
+		return
+	}
+
+	hasMore := len(msgs) > requested
+	if hasMore {
+		// Drop the extra row from the end furthest from the cursor.
+		if opts.After != "" {
+			msgs = msgs[:requested]
+		} else {
+			msgs = msgs[1:]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages": msgs,
+		"has_more": hasMore,
+	})
+}
+
+// handleMessage serves /api/messages/{id}, dispatching on method.
+func handleMessage(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPatch:
+		handleEditMessageRequest(hub, w, r)
+	case http.MethodDelete:
+		handleDeleteMessageRequest(hub, w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// isUUID reports whether s is a UUID in its canonical textual form, so that
+// malformed IDs are rejected before they reach the database.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestIsUUID(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"123e4567-e89b-12d3-a456-426614174000", true},
+		{"123E4567-E89B-12D3-A456-426614174000", true},
+		{"", false},
+		{"not-a-uuid", false},
+		{"123e4567e89b12d3a456426614174000", false},
+		{"123e4567-e89b-12d3-a456-42661417400g", false},
+		{"123e4567-e89b-12d3-a456_426614174000", false},
+		{"123e4567-e89b-12d3-a456-4266141740000", false},
+	}
+	for _, tt := range tests {
+		if got := isUUID(tt.in); got != tt.want {
+			t.Errorf("isUUID(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
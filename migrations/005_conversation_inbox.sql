@@ -0,0 +1,7 @@
+ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS last_read_at TIMESTAMP WITH TIME ZONE;
+
+-- Inbox lookups start from the caller's memberships; the composite index
+-- supersedes the single-column one from 003.
+DROP INDEX IF EXISTS idx_conversation_members_user_id;
+CREATE INDEX IF NOT EXISTS idx_conversation_members_user_id_conversation_id ON conversation_members(user_id, conversation_id);
+CREATE INDEX IF NOT EXISTS idx_conversation_members_conversation_id_joined_at ON conversation_members(conversation_id, joined_at);
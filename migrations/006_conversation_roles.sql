@@ -0,0 +1,12 @@
+ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member'
+    CHECK (role IN ('owner', 'admin', 'member'));
+
+-- Existing group creators become owners.
+UPDATE conversation_members m
+SET role = 'owner'
+FROM conversations c
+WHERE c.id = m.conversation_id
+    AND c.type = 'group'
+    AND m.user_id = c.created_by;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversation_members_one_owner ON conversation_members(conversation_id) WHERE role = 'owner';
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
@@ -0,0 +1,66 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_normalized VARCHAR(50);
+
+-- Usernames are normalized by lowering ASCII letters only, exactly as
+-- user.NormalizeUsername does. LOWER() would also fold non-ASCII letters,
+-- and differently depending on the database locale.
+
+-- Accounts renamed below, so that their owners can be told.
+CREATE TABLE IF NOT EXISTS username_renames (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_username VARCHAR(50) NOT NULL,
+    new_username VARCHAR(50) NOT NULL,
+    renamed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Accounts whose usernames differ only in case cannot coexist once
+-- uniqueness ignores case. The oldest keeps its name; the others are renamed
+-- to <name>-<8 hex digits of their ID>, sliding along the ID until the new
+-- name is free.
+DO $$
+DECLARE
+    dup RECORD;
+    hex TEXT;
+    candidate TEXT;
+    offs INT;
+BEGIN
+    FOR dup IN
+        SELECT id, username FROM (
+            SELECT id, username, ROW_NUMBER() OVER (
+                PARTITION BY TRANSLATE(username, 'ABCDEFGHIJKLMNOPQRSTUVWXYZ', 'abcdefghijklmnopqrstuvwxyz')
+                ORDER BY created_at, id
+            ) AS n
+            FROM users
+            WHERE username_normalized IS NULL
+        ) ranked
+        WHERE n > 1
+        ORDER BY username, id
+    LOOP
+        hex := REPLACE(dup.id::text, '-', '');
+        offs := 1;
+        LOOP
+            IF offs > LENGTH(hex) - 7 THEN
+                RAISE EXCEPTION 'no free username to rename % (%) to', dup.username, dup.id;
+            END IF;
+            candidate := LEFT(dup.username, 41) || '-' || SUBSTR(hex, offs, 8);
+            EXIT WHEN NOT EXISTS (
+                SELECT 1 FROM users
+                WHERE TRANSLATE(username, 'ABCDEFGHIJKLMNOPQRSTUVWXYZ', 'abcdefghijklmnopqrstuvwxyz')
+                    = TRANSLATE(candidate, 'ABCDEFGHIJKLMNOPQRSTUVWXYZ', 'abcdefghijklmnopqrstuvwxyz')
+            );
+            offs := offs + 1;
+        END LOOP;
+
+        UPDATE users SET username = candidate WHERE id = dup.id;
+        INSERT INTO username_renames (user_id, old_username, new_username)
+        VALUES (dup.id, dup.username, candidate);
+        RAISE NOTICE 'renamed user % from % to %', dup.id, dup.username, candidate;
+    END LOOP;
+END $$;
+
+UPDATE users
+SET username_normalized = TRANSLATE(username, 'ABCDEFGHIJKLMNOPQRSTUVWXYZ', 'abcdefghijklmnopqrstuvwxyz')
+WHERE username_normalized IS NULL;
+
+ALTER TABLE users ALTER COLUMN username_normalized SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_normalized ON users(username_normalized);
@@ -0,0 +1,7 @@
+-- Delivered and read watermarks. A watermark is the (created_at, id) of the
+-- last message acknowledged, matching the order messages are listed in.
+-- last_read_at already exists from 005 and now holds the read message's
+-- created_at.
+ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS last_read_message_id UUID;
+ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS last_delivered_message_id UUID;
+ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS last_delivered_at TIMESTAMP WITH TIME ZONE;
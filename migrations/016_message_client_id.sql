@@ -0,0 +1,5 @@
+-- Sender-generated IDs used to de-duplicate retried sends. NULL for
+-- messages sent without one, which the partial index ignores.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_sender_id_client_id ON messages(sender_id, client_id) WHERE client_id IS NOT NULL;
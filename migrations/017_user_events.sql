@@ -0,0 +1,17 @@
+-- Per-user event streams for reconnect catch-up. The counter is kept apart
+-- from the events so that numbering continues after old events are purged.
+CREATE TABLE IF NOT EXISTS user_event_seqs (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_seq BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_events (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,
+    type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_events_created_at ON user_events(created_at);
@@ -0,0 +1,21 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Messages deleted for everyone stay behind as tombstones with empty content.
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_content_check;
+ALTER TABLE messages ADD CONSTRAINT messages_content_check
+    CHECK (deleted_at IS NOT NULL OR char_length(content) BETWEEN 1 AND 2000);
+
+-- Messages a user deleted for themselves only.
+CREATE TABLE IF NOT EXISTS hidden_messages (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hidden_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (message_id, user_id)
+);
+
+-- Lets deleting a message for everyone find the copies of its content kept
+-- in user_events for replay.
+CREATE INDEX IF NOT EXISTS idx_user_events_message_id
+    ON user_events ((payload->>'message_id'))
+    WHERE payload ? 'content';
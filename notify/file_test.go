@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileNotifierAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	n := NewFileNotifier(path)
+	ctx := context.Background()
+
+	for _, subject := range []string{"first", "second"} {
+		if err := n.Send(ctx, Message{UserID: "user-123", Username: "alice", Subject: subject, Body: "body"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening outbox: %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var got []Message
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, msg)
+	}
+
+	if len(got) != 2 || got[0].Subject != "first" || got[1].Subject != "second" {
+		t.Fatalf("expected both messages in order, got %+v", got)
+	}
+	if got[0].SentAt.IsZero() {
+		t.Error("expected SentAt to be filled in")
+	}
+}
@@ -0,0 +1,23 @@
+// Package notify delivers out-of-band messages, such as password reset
+// tokens, to users.
+package notify
+
+import (
+	"context"
+	"time"
+)
+
+// Message is a notification addressed to a user.
+type Message struct {
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username"`
+	Subject  string    `json:"subject"`
+	Body     string    `json:"body"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// Notifier delivers messages to users. Implementations must be safe for
+// concurrent use.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
@@ -0,0 +1,108 @@
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Argon2id hashes passwords with argon2id. Memory is in KiB.
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2id follows the OWASP baseline recommendation.
+var DefaultArgon2id = Argon2id{
+	Time:    2,
+	Memory:  19 * 1024,
+	Threads: 1,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+var b64 = base64.RawStdEncoding
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, a.Memory, a.Time, a.Threads,
+		b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (a Argon2id) Verify(password, encoded string) (bool, error) {
+	return Verify(password, encoded)
+}
+
+func (a Argon2id) NeedsRehash(encoded string) bool {
+	h, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return h.params.Time != a.Time ||
+		h.params.Memory != a.Memory ||
+		h.params.Threads != a.Threads ||
+		uint32(len(h.salt)) != a.SaltLen ||
+		uint32(len(h.key)) != a.KeyLen
+}
+
+type argon2idHash struct {
+	params Argon2id
+	salt   []byte
+	key    []byte
+}
+
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrInvalidHash
+	}
+
+	var h argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.params.Memory, &h.params.Time, &h.params.Threads); err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	var err error
+	if h.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if h.key, err = b64.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, ErrInvalidHash
+	}
+	if h.params.Time == 0 || h.params.Threads == 0 {
+		return nil, ErrInvalidHash
+	}
+
+	return &h, nil
+}
+
+func verifyArgon2id(password, encoded string) (bool, error) {
+	h, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), h.salt, h.params.Time, h.params.Memory, h.params.Threads, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+}
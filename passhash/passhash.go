@@ -0,0 +1,48 @@
+// Package passhash hashes and verifies passwords.
+//
+// Hashes are stored in self-describing modular crypt / PHC string format, so
+// that a hash records the algorithm and parameters it was made with:
+//
+//	$2a$10$<salt+hash>                              (bcrypt)
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>    (argon2id)
+//
+// This lets a server switch algorithms or raise costs while still accepting
+// every existing hash, and upgrade each one the next time its owner logs in.
+package passhash
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrUnknownScheme = errors.New("unknown password hash scheme")
+	ErrInvalidHash   = errors.New("malformed password hash")
+)
+
+// Hasher hashes new passwords with one configured scheme.
+type Hasher interface {
+	// Hash returns the encoded hash of password.
+	Hash(password string) (string, error)
+
+	// Verify reports whether password matches encoded. Any supported
+	// scheme is accepted, not only the hasher's own.
+	Verify(password, encoded string) (bool, error)
+
+	// NeedsRehash reports whether encoded was produced by a different
+	// scheme or with different parameters than Hash would use now.
+	NeedsRehash(encoded string) bool
+}
+
+// Verify reports whether password matches encoded, using whichever
+// supported scheme produced it.
+func Verify(password, encoded string) (bool, error) {
+	switch {
+	case isBcrypt(encoded):
+		return verifyBcrypt(password, encoded)
+	case strings.HasPrefix(encoded, argon2idPrefix):
+		return verifyArgon2id(password, encoded)
+	default:
+		return false, ErrUnknownScheme
+	}
+}
@@ -0,0 +1,85 @@
+package passhash
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2id keeps the tests fast; production parameters are far higher.
+var testArgon2id = Argon2id{Time: 1, Memory: 64, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func TestHashAndVerify(t *testing.T) {
+	hashers := map[string]Hasher{
+		"bcrypt":   Bcrypt{Cost: bcrypt.MinCost},
+		"argon2id": testArgon2id,
+	}
+
+	for name, h := range hashers {
+		encoded, err := h.Hash("correct horse")
+		if err != nil {
+			t.Fatalf("%s: unexpected error hashing: %v", name, err)
+		}
+
+		if ok, err := h.Verify("correct horse", encoded); err != nil || !ok {
+			t.Errorf("%s: expected password to verify, got %v %v", name, ok, err)
+		}
+		if ok, err := h.Verify("wrong horse", encoded); err != nil || ok {
+			t.Errorf("%s: expected wrong password to be rejected, got %v %v", name, ok, err)
+		}
+		if h.NeedsRehash(encoded) {
+			t.Errorf("%s: fresh hash should not need a rehash", name)
+		}
+	}
+}
+
+func TestArgon2idEncoding(t *testing.T) {
+	encoded, err := testArgon2id.Hash("secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("unexpected encoding: %s", encoded)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	oldBcrypt, _ := Bcrypt{Cost: bcrypt.MinCost}.Hash("secret")
+	oldArgon, _ := testArgon2id.Hash("secret")
+
+	if !(Bcrypt{Cost: bcrypt.MinCost + 1}).NeedsRehash(oldBcrypt) {
+		t.Error("expected bcrypt hash with a lower cost to need a rehash")
+	}
+	if !testArgon2id.NeedsRehash(oldBcrypt) {
+		t.Error("expected bcrypt hash to need a rehash when argon2id is preferred")
+	}
+
+	stronger := testArgon2id
+	stronger.Memory = 128
+	if !stronger.NeedsRehash(oldArgon) {
+		t.Error("expected argon2id hash with less memory to need a rehash")
+	}
+	if !(Bcrypt{Cost: bcrypt.MinCost}).NeedsRehash(oldArgon) {
+		t.Error("expected argon2id hash to need a rehash when bcrypt is preferred")
+	}
+
+	// Whatever the preferred scheme, every supported hash still verifies.
+	for _, encoded := range []string{oldBcrypt, oldArgon} {
+		if ok, err := stronger.Verify("secret", encoded); err != nil || !ok {
+			t.Errorf("expected %s to verify, got %v %v", encoded, ok, err)
+		}
+	}
+}
+
+func TestVerifyRejectsUnknownAndMalformed(t *testing.T) {
+	if _, err := Verify("secret", "plaintext"); err != ErrUnknownScheme {
+		t.Errorf("expected ErrUnknownScheme, got %v", err)
+	}
+	if _, err := Verify("secret", "$argon2id$v=19$m=64,t=1,p=1$not-base64!$x"); err != ErrInvalidHash {
+		t.Errorf("expected ErrInvalidHash, got %v", err)
+	}
+	if _, err := Verify("secret", "$2a$10$short"); err != ErrInvalidHash {
+		t.Errorf("expected ErrInvalidHash for truncated bcrypt hash, got %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nexus-im/nexus/notify"
+	"github.com/nexus-im/nexus/store/user"
+)
+
+const (
+	passwordResetTTL = time.Hour
+
+	// passwordResetSendTimeout bounds the work done for a reset request
+	// after it has been answered.
+	passwordResetSendTimeout = 30 * time.Second
+)
+
+// hashPassword returns the stored form of a new password.
+func hashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
+// checkPassword verifies password against u's stored hash. A mismatch counts
+// as a failed login and is answered with 401; either way an error response
+// has been written when it returns false.
+func checkPassword(w http.ResponseWriter, r *http.Request, u *user.User, password, ipKey, userKey string) bool {
+	ok, err := passwordHasher.Verify(password, u.PasswordHash)
+	if err != nil {
+		log.Printf("Error verifying password for user %s: %v", u.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		recordLoginFailure(r, ipKey, userKey)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// rehashPassword upgrades u's stored hash after a successful login if it was
+// made with another scheme or outdated parameters. Failures are only logged;
+// the old hash keeps working.
+func rehashPassword(ctx context.Context, u *user.User, password string) {
+	if !passwordHasher.NeedsRehash(u.PasswordHash) {
+		return
+	}
+
+	hashed, err := hashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password for user %s: %v", u.ID, err)
+		return
+	}
+	if err := userStore.UpdatePassword(ctx, u.ID, hashed); err != nil {
+		log.Printf("Error storing rehashed password for user %s: %v", u.ID, err)
+		return
+	}
+	u.PasswordHash = hashed
+}
+
+// handleChangePassword serves PUT /api/password. Every other session of the
+// user is revoked; the one making the request stays logged in.
+func handleChangePassword(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sess, err := authenticateSession(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.CurrentPassword == "" {
+		http.Error(w, "Current password is required", http.StatusBadRequest)
+		return
+	}
+	if verr := passwordPolicy.Validate(req.NewPassword); verr != nil {
+		writeValidationError(w, verr)
+		return
+	}
+
+	u, err := userStore.GetByID(r.Context(), sess.UserID)
+	if err != nil {
+		log.Printf("Error loading user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Checking the current password is a password guess like any other.
+	ipKey := "ip:" + clientIP(r)
+	userKey := loginUserKey(u.Username)
+	if !allowLoginAttempt(w, r, ipKey, userKey) {
+		return
+	}
+	if !checkPassword(w, r, u, req.CurrentPassword, ipKey, userKey) {
+		return
+	}
+
+	hashed, ok := hashNewPassword(w, req.NewPassword)
+	if !ok {
+		return
+	}
+	if err := userStore.ChangePassword(r.Context(), u.ID, hashed); err != nil {
+		log.Printf("Error updating password: %v", err)
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
+	ids, err := sessionStore.DeleteOthers(r.Context(), u.ID, sess.ID)
+	if err != nil {
+		log.Printf("Error revoking sessions after password change: %v", err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	hub.revokeSessions(ids)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRequestPasswordReset serves POST /api/password/reset-request. The
+// response is the same whether or not the username exists, so it cannot be
+// used to enumerate accounts. Without a notifier there is no way to reach
+// the user, and the endpoint answers 501.
+func handleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if notifier == nil {
+		http.Error(w, "Password reset is not configured", http.StatusNotImplemented)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Username == "" {
+		http.Error(w, "Username is required", http.StatusBadRequest)
+		return
+	}
+
+	// Reset requests are counted apart from logins, so that flooding them
+	// cannot lock the user out.
+	if !allowLoginAttempt(w, r, "ip:"+clientIP(r), resetUserKey(req.Username)) {
+		return
+	}
+
+	// The lookup and delivery happen after responding, so that the
+	// response takes as long whether or not the account exists.
+	go issuePasswordReset(req.Username)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// issuePasswordReset sends a reset token to the user called username, if
+// there is one. It runs detached from the request; failures are logged.
+func issuePasswordReset(username string) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordResetSendTimeout)
+	defer cancel()
+
+	u, err := userStore.GetByUsername(ctx, username)
+	if err == nil {
+		err = sendPasswordReset(ctx, u)
+	}
+	if err != nil && err != user.ErrUserNotFound {
+		log.Printf("Error issuing password reset: %v", err)
+	}
+}
+
+func sendPasswordReset(ctx context.Context, u *user.User) error {
+	token, err := generateSessionToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reset := &user.PasswordReset{
+		Token:     token,
+		UserID:    u.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(passwordResetTTL),
+	}
+	if err := userStore.CreatePasswordReset(ctx, reset); err != nil {
+		return err
+	}
+
+	return notifier.Send(ctx, notify.Message{
+		UserID:   u.ID,
+		Username: u.Username,
+		Subject:  "Reset your password",
+		Body: fmt.Sprintf("Use this token to choose a new password within %s: %s",
+			passwordResetTTL, token),
+		SentAt: now,
+	})
+}
+
+// handleResetPassword serves POST /api/password/reset. Redeeming a reset
+// token logs the user out everywhere.
+func handleResetPassword(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+	// Validate before redeeming, so a rejected password does not burn the
+	// token.
+	if verr := passwordPolicy.Validate(req.NewPassword); verr != nil {
+		writeValidationError(w, verr)
+		return
+	}
+
+	// Hash first: the token is only spent together with the password
+	// update.
+	hashed, ok := hashNewPassword(w, req.NewPassword)
+	if !ok {
+		return
+	}
+
+	reset, err := userStore.ResetPassword(r.Context(), req.Token, hashed)
+	if err == user.ErrResetTokenInvalid {
+		http.Error(w, "Invalid or expired reset token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("Error resetting password: %v", err)
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
+	ids, err := sessionStore.DeleteByUser(r.Context(), reset.UserID)
+	if err != nil {
+		log.Printf("Error revoking sessions after password reset: %v", err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	hub.revokeSessions(ids)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// hashNewPassword hashes a new password, writing an error response if that
+// fails.
+func hashNewPassword(w http.ResponseWriter, password string) (string, bool) {
+	hashed, err := hashPassword(password)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", false
+	}
+	return hashed, true
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy configures the strength rules for new passwords.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters.
+	MinLength int
+	// MaxLength is the maximum length in bytes. bcrypt ignores everything
+	// past 72 bytes, so that is the sensible ceiling when bcrypt is used.
+	MaxLength int
+	// MinClasses is how many of the four character classes (lower case,
+	// upper case, digits, everything else) must appear.
+	MinClasses int
+}
+
+// DefaultPasswordPolicy is the policy used when none is configured.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:  8,
+	MaxLength:  72,
+	MinClasses: 1,
+}
+
+// Validate checks a new password against the policy.
+func (p PasswordPolicy) Validate(password string) *Error {
+	var e Error
+
+	if password == "" {
+		e.add("password", CodeRequired, "Password is required")
+		return &e
+	}
+
+	if !utf8.ValidString(password) {
+		e.add("password", CodeInvalidCharacters, "Password must be valid UTF-8")
+		return &e
+	}
+
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsControl(r):
+			e.add("password", CodeInvalidCharacters, "Password may not contain control characters")
+			return &e
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		e.add("password", CodeTooShort, fmt.Sprintf("Password must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		e.add("password", CodeTooLong, fmt.Sprintf("Password must be at most %d bytes", p.MaxLength))
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+	if classes < p.MinClasses {
+		e.add("password", CodeTooWeak, fmt.Sprintf("Password must mix at least %d of: lower case, upper case, digits, symbols", p.MinClasses))
+	}
+
+	return e.orNil()
+}
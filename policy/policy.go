@@ -0,0 +1,61 @@
+// Package policy validates user-chosen credentials.
+package policy
+
+import "strings"
+
+// Violation describes one rule a value failed.
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Violation codes.
+const (
+	CodeRequired          = "required"
+	CodeTooShort          = "too_short"
+	CodeTooLong           = "too_long"
+	CodeInvalidCharacters = "invalid_characters"
+	CodeInvalidFormat     = "invalid_format"
+	CodeTooWeak           = "too_weak"
+)
+
+// Error collects every violation found in a request, so that clients can
+// report them all at once.
+type Error struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Field + ": " + v.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Merge combines the violations of several validation results, any of
+// which may be nil. It returns nil if there are none.
+func Merge(errs ...*Error) *Error {
+	var merged Error
+	for _, err := range errs {
+		if err != nil {
+			merged.Violations = append(merged.Violations, err.Violations...)
+		}
+	}
+	if len(merged.Violations) == 0 {
+		return nil
+	}
+	return &merged
+}
+
+func (e *Error) add(field, code, message string) {
+	e.Violations = append(e.Violations, Violation{Field: field, Code: code, Message: message})
+}
+
+func (e *Error) orNil() *Error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func codes(err *Error) []string {
+	if err == nil {
+		return nil
+	}
+	var out []string
+	for _, v := range err.Violations {
+		out = append(out, v.Code)
+	}
+	return out
+}
+
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"alice", nil},
+		{"Alice.Smith-2_b", nil},
+		{"", []string{CodeRequired}},
+		{"ab", []string{CodeTooShort}},
+		{strings.Repeat("a", 51), []string{CodeTooLong}},
+		{"alice smith", []string{CodeInvalidCharacters}},
+		{"alice\x00", []string{CodeInvalidCharacters}},
+		{"аlice", []string{CodeInvalidCharacters}}, // Cyrillic а
+		{"_alice", []string{CodeInvalidFormat}},
+		{"alice.", []string{CodeInvalidFormat}},
+		{"al..ice", []string{CodeInvalidFormat}},
+	}
+
+	for _, tt := range tests {
+		got := codes(ValidateUsername(tt.name))
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("ValidateUsername(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	p := PasswordPolicy{MinLength: 8, MaxLength: 72, MinClasses: 3}
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{"Secret123", nil},
+		{"Pässwort1", nil},
+		{"", []string{CodeRequired}},
+		{"Ab1", []string{CodeTooShort}},
+		{"alllowercase", []string{CodeTooWeak}},
+		{"Ab1" + strings.Repeat("x", 70), []string{CodeTooLong}},
+		{"short", []string{CodeTooShort, CodeTooWeak}},
+		{"Secret123\n", []string{CodeInvalidCharacters}},
+		{"Secret123\xff", []string{CodeInvalidCharacters}},
+	}
+
+	for _, tt := range tests {
+		got := codes(p.Validate(tt.password))
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Validate(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	if Merge(nil, nil) != nil {
+		t.Error("expected nil when nothing failed")
+	}
+
+	err := Merge(ValidateUsername(""), nil, DefaultPasswordPolicy.Validate("x"))
+	if got := codes(err); strings.Join(got, ",") != "required,too_short" {
+		t.Errorf("unexpected merged codes: %v", got)
+	}
+	if !strings.Contains(err.Error(), "username: Username is required") {
+		t.Errorf("unexpected error string: %s", err.Error())
+	}
+}
@@ -0,0 +1,56 @@
+package policy
+
+import "fmt"
+
+const (
+	MinUsernameLength = 3
+	// MaxUsernameLength matches the users.username column.
+	MaxUsernameLength = 50
+)
+
+// ValidateUsername checks a username for registration. Usernames are
+// restricted to ASCII letters, digits and the separators '.', '_' and '-' so
+// that no two accounts can look alike; they must start and end with a
+// letter or digit and may not repeat separators. Uniqueness is
+// case-insensitive and enforced by the store.
+func ValidateUsername(name string) *Error {
+	var e Error
+
+	switch {
+	case name == "":
+		e.add("username", CodeRequired, "Username is required")
+		return &e
+	case len(name) < MinUsernameLength:
+		e.add("username", CodeTooShort, fmt.Sprintf("Username must be at least %d characters", MinUsernameLength))
+	case len(name) > MaxUsernameLength:
+		e.add("username", CodeTooLong, fmt.Sprintf("Username must be at most %d characters", MaxUsernameLength))
+	}
+
+	for i := 0; i < len(name); i++ {
+		if !isAlnum(name[i]) && !isSeparator(name[i]) {
+			e.add("username", CodeInvalidCharacters, "Username may only contain letters, digits, '.', '_' and '-'")
+			return e.orNil()
+		}
+	}
+
+	if !isAlnum(name[0]) || !isAlnum(name[len(name)-1]) {
+		e.add("username", CodeInvalidFormat, "Username must start and end with a letter or digit")
+	} else {
+		for i := 1; i < len(name); i++ {
+			if isSeparator(name[i]) && isSeparator(name[i-1]) {
+				e.add("username", CodeInvalidFormat, "Username may not contain consecutive separators")
+				break
+			}
+		}
+	}
+
+	return e.orNil()
+}
+
+func isAlnum(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func isSeparator(c byte) bool {
+	return c == '.' || c == '_' || c == '-'
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Presence statuses. A user is online if any of their connections is
+// active, away if all of them are idle, and offline without connections.
+const (
+	presenceOnline  = "online"
+	presenceAway    = "away"
+	presenceOffline = "offline"
+)
+
+type setPresencePayload struct {
+	Status string `json:"status"`
+}
+
+type presenceChangedPayload struct {
+	UserID   string     `json:"user_id"`
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// awayChange asks the hub to mark a single connection idle or active.
+type awayChange struct {
+	client *Client
+	away   bool
+}
+
+// presenceQuery asks the hub for the current status of some users.
+type presenceQuery struct {
+	userIDs []string
+	reply   chan map[string]string
+}
+
+// handleSetPresence lets a connection report that its user went idle or came
+// back. The user's status is derived from all of their connections.
+func handleSetPresence(ctx context.Context, c *Client, raw json.RawMessage) error {
+	var p setPresencePayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return invalidPayload("malformed set_presence payload")
+	}
+
+	switch p.Status {
+	case presenceOnline:
+		c.hub.setAway <- awayChange{client: c, away: false}
+	case presenceAway:
+		c.hub.setAway <- awayChange{client: c, away: true}
+	default:
+		return invalidPayload("status must be online or away")
+	}
+	return nil
+}
+
+// presenceOf returns the status of each of userIDs.
+func (h *Hub) presenceOf(userIDs []string) map[string]string {
+	q := &presenceQuery{userIDs: userIDs, reply: make(chan map[string]string, 1)}
+	h.presenceQuery <- q
+	return <-q.reply
+}
+
+// userPresence derives a user's status from their connections. It must only
+// be called from the hub's run loop.
+func (h *Hub) userPresence(userID string) string {
+	conns := h.clients[userID]
+	if len(conns) == 0 {
+		return presenceOffline
+	}
+	for client := range conns {
+		if !client.away {
+			return presenceOnline
+		}
+	}
+	return presenceAway
+}
+
+// updatePresence recomputes userID's status after one of their connections
+// changed and queues an announcement if it differs from the last one. It
+// must only be called from the hub's run loop.
+func (h *Hub) updatePresence(userID string) {
+	status := h.userPresence(userID)
+	previous, ok := h.status[userID]
+	if !ok {
+		previous = presenceOffline
+	}
+	if status == previous {
+		return
+	}
+
+	if status == presenceOffline {
+		delete(h.status, userID)
+	} else {
+		h.status[userID] = status
+	}
+	h.presence.enqueue(userID, status, time.Now())
+}
+
+// presenceUpdate is a pending announcement for one user.
+type presenceUpdate struct {
+	status string
+	// wentOffline is set if the user's last connection closed since the
+	// previous announcement, even if they have reconnected since.
+	wentOffline time.Time
+}
+
+// presenceNotifier announces presence changes to the users who share a
+// conversation with the user concerned. It needs the database, so it runs
+// outside the hub loop. Updates are coalesced per user: if a user flaps
+// faster than they can be announced, only the latest status is sent.
+type presenceNotifier struct {
+	hub *Hub
+
+	mu      sync.Mutex
+	pending map[string]presenceUpdate
+	wake    chan struct{}
+}
+
+func newPresenceNotifier(h *Hub) *presenceNotifier {
+	return &presenceNotifier{
+		hub:     h,
+		pending: make(map[string]presenceUpdate),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// enqueue records a status change. It never blocks, so it is safe to call
+// from the hub loop.
+func (n *presenceNotifier) enqueue(userID, status string, at time.Time) {
+	n.mu.Lock()
+	u := n.pending[userID]
+	u.status = status
+	if status == presenceOffline {
+		u.wentOffline = at
+	}
+	n.pending[userID] = u
+	n.mu.Unlock()
+
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (n *presenceNotifier) run() {
+	for range n.wake {
+		n.mu.Lock()
+		batch := n.pending
+		n.pending = make(map[string]presenceUpdate)
+		n.mu.Unlock()
+
+		for userID, u := range batch {
+			n.announce(context.Background(), userID, u)
+		}
+	}
+}
+
+func (n *presenceNotifier) announce(ctx context.Context, userID string, u presenceUpdate) {
+	payload := presenceChangedPayload{UserID: userID, Status: u.status}
+
+	if !u.wentOffline.IsZero() {
+		if err := userStore.UpdateLastSeen(ctx, userID, u.wentOffline); err != nil {
+			log.Printf("error updating last seen for %s: %v", userID, err)
+		}
+		if u.status == presenceOffline {
+			payload.LastSeen = &u.wentOffline
+		}
+	}
+
+	contacts, err := conversationStore.ListContactIDs(ctx, userID)
+	if err != nil {
+		log.Printf("error listing contacts of %s: %v", userID, err)
+		return
+	}
+	if len(contacts) == 0 {
+		return
+	}
+
+	if err := n.hub.sendToUsers(contacts, eventPresenceChanged, payload); err != nil {
+		log.Printf("error encoding presence_changed: %v", err)
+	}
+}
+
+// handlePresence serves GET /api/presence, returning the current status of
+// everyone who shares a conversation with the caller.
+func handlePresence(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	contacts, err := conversationStore.ListContactIDs(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing contacts: %v", err)
+		http.Error(w, "Failed to load presence", http.StatusInternalServerError)
+		return
+	}
+
+	statuses := hub.presenceOf(contacts)
+	presence := make([]presenceChangedPayload, 0, len(contacts))
+	for _, id := range contacts {
+		presence = append(presence, presenceChangedPayload{UserID: id, Status: statuses[id]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"presence": presence,
+	})
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often idle keys are dropped from memory.
+const pruneInterval = time.Minute
+
+// maxBackoffShift bounds the exponent of the backoff delay so that it cannot
+// overflow.
+const maxBackoffShift = 30
+
+// MemoryLimiter is a Limiter that keeps its state in process memory.
+type MemoryLimiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastPrune time.Time
+}
+
+type entry struct {
+	tokens       float64
+	refilledAt   time.Time
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// NewMemoryLimiter creates a MemoryLimiter with the given configuration.
+func NewMemoryLimiter(cfg Config) *MemoryLimiter {
+	return &MemoryLimiter{
+		cfg:     cfg,
+		now:     time.Now,
+		entries: make(map[string]*entry),
+	}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string) (time.Duration, error) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pruneLocked(now)
+	e := l.entryLocked(key, now)
+
+	if now.Before(e.blockedUntil) {
+		return e.blockedUntil.Sub(now), nil
+	}
+
+	l.refill(e, now)
+	if e.tokens < 1 {
+		wait := time.Duration((1 - e.tokens) / l.cfg.Rate * float64(time.Second))
+		if wait <= 0 {
+			wait = time.Nanosecond
+		}
+		return wait, nil
+	}
+	e.tokens--
+
+	return 0, nil
+}
+
+func (l *MemoryLimiter) RecordFailure(ctx context.Context, key string) error {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := l.entryLocked(key, now)
+	if l.failuresExpired(e, now) {
+		e.failures = 0
+	}
+	e.failures++
+	e.lastFailure = now
+
+	var block time.Duration
+	if l.cfg.LockoutThreshold > 0 && e.failures >= l.cfg.LockoutThreshold {
+		block = l.cfg.LockoutDuration
+	} else if e.failures > l.cfg.FreeFailures && l.cfg.BaseDelay > 0 {
+		shift := e.failures - l.cfg.FreeFailures - 1
+		if shift > maxBackoffShift {
+			shift = maxBackoffShift
+		}
+		block = l.cfg.BaseDelay << shift
+		if l.cfg.MaxDelay > 0 && block > l.cfg.MaxDelay {
+			block = l.cfg.MaxDelay
+		}
+	}
+
+	if until := now.Add(block); until.After(e.blockedUntil) {
+		e.blockedUntil = until
+	}
+
+	return nil
+}
+
+func (l *MemoryLimiter) Reset(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.entries[key]; ok {
+		e.failures = 0
+		e.lastFailure = time.Time{}
+		e.blockedUntil = time.Time{}
+	}
+
+	return nil
+}
+
+func (l *MemoryLimiter) entryLocked(key string, now time.Time) *entry {
+	e, ok := l.entries[key]
+	if !ok {
+		e = &entry{tokens: float64(l.cfg.Burst), refilledAt: now}
+		l.entries[key] = e
+	}
+	return e
+}
+
+func (l *MemoryLimiter) refill(e *entry, now time.Time) {
+	elapsed := now.Sub(e.refilledAt).Seconds()
+	if elapsed > 0 {
+		e.tokens = min(e.tokens+elapsed*l.cfg.Rate, float64(l.cfg.Burst))
+	}
+	e.refilledAt = now
+}
+
+func (l *MemoryLimiter) failuresExpired(e *entry, now time.Time) bool {
+	return l.cfg.FailureWindow > 0 && now.Sub(e.lastFailure) > l.cfg.FailureWindow
+}
+
+// pruneLocked drops keys that carry no state a fresh entry would not have:
+// a full bucket, no block and no failures worth remembering.
+func (l *MemoryLimiter) pruneLocked(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	for key, e := range l.entries {
+		if now.Before(e.blockedUntil) {
+			continue
+		}
+		if e.failures > 0 && !l.failuresExpired(e, now) {
+			continue
+		}
+		l.refill(e, now)
+		if e.tokens >= float64(l.cfg.Burst) {
+			delete(l.entries, key)
+		}
+	}
+}
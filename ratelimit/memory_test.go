@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(cfg Config) (*MemoryLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewMemoryLimiter(cfg)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestAllowTokenBucket(t *testing.T) {
+	l, clock := newTestLimiter(Config{Rate: 1, Burst: 2})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if wait, err := l.Allow(ctx, "k"); err != nil || wait != 0 {
+			t.Fatalf("attempt %d: expected to be allowed, got wait=%v err=%v", i, wait, err)
+		}
+	}
+
+	wait, err := l.Allow(ctx, "k")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wait != time.Second {
+		t.Errorf("expected to wait 1s for the next token, got %v", wait)
+	}
+
+	// Other keys have their own bucket.
+	if wait, _ := l.Allow(ctx, "other"); wait != 0 {
+		t.Errorf("expected other key to be allowed, got wait=%v", wait)
+	}
+
+	clock.advance(time.Second)
+	if wait, _ := l.Allow(ctx, "k"); wait != 0 {
+		t.Errorf("expected refilled token to be allowed, got wait=%v", wait)
+	}
+}
+
+func TestRecordFailureBackoff(t *testing.T) {
+	l, clock := newTestLimiter(Config{
+		Rate:         100,
+		Burst:        100,
+		FreeFailures: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     4 * time.Second,
+	})
+	ctx := context.Background()
+
+	// Free failures do not block.
+	for i := 0; i < 2; i++ {
+		_ = l.RecordFailure(ctx, "k")
+	}
+	if wait, _ := l.Allow(ctx, "k"); wait != 0 {
+		t.Fatalf("expected no backoff within free failures, got %v", wait)
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for i, want := range expected {
+		_ = l.RecordFailure(ctx, "k")
+		if wait, _ := l.Allow(ctx, "k"); wait != want {
+			t.Errorf("failure %d: expected backoff %v, got %v", i+3, want, wait)
+		}
+		clock.advance(want)
+	}
+}
+
+func TestRecordFailureLockout(t *testing.T) {
+	l, clock := newTestLimiter(Config{
+		Rate:             100,
+		Burst:            100,
+		FreeFailures:     100,
+		LockoutThreshold: 3,
+		LockoutDuration:  15 * time.Minute,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_ = l.RecordFailure(ctx, "k")
+	}
+	if wait, _ := l.Allow(ctx, "k"); wait != 15*time.Minute {
+		t.Fatalf("expected 15m lockout, got %v", wait)
+	}
+
+	clock.advance(15 * time.Minute)
+	if wait, _ := l.Allow(ctx, "k"); wait != 0 {
+		t.Errorf("expected lockout to have lapsed, got %v", wait)
+	}
+
+	// Still over the threshold: one more failure locks again.
+	_ = l.RecordFailure(ctx, "k")
+	if wait, _ := l.Allow(ctx, "k"); wait != 15*time.Minute {
+		t.Errorf("expected lockout to be renewed, got %v", wait)
+	}
+}
+
+func TestFailureWindowAndReset(t *testing.T) {
+	l, clock := newTestLimiter(Config{
+		Rate:             100,
+		Burst:            100,
+		FreeFailures:     100,
+		LockoutThreshold: 2,
+		LockoutDuration:  time.Minute,
+		FailureWindow:    10 * time.Minute,
+	})
+	ctx := context.Background()
+
+	_ = l.RecordFailure(ctx, "k")
+	clock.advance(11 * time.Minute)
+	_ = l.RecordFailure(ctx, "k")
+	if wait, _ := l.Allow(ctx, "k"); wait != 0 {
+		t.Errorf("expected stale failure to be forgotten, got %v", wait)
+	}
+
+	_ = l.RecordFailure(ctx, "k")
+	if wait, _ := l.Allow(ctx, "k"); wait == 0 {
+		t.Fatal("expected lockout after two recent failures")
+	}
+
+	_ = l.Reset(ctx, "k")
+	if wait, _ := l.Allow(ctx, "k"); wait != 0 {
+		t.Errorf("expected reset to lift the lockout, got %v", wait)
+	}
+}
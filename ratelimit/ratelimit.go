@@ -0,0 +1,53 @@
+// Package ratelimit throttles repeated attempts, such as password guesses,
+// per key.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter combines a token bucket with failure-driven backoff. Keys are
+// opaque to the limiter; callers typically prefix them with what they
+// identify (an IP address, a username).
+//
+// Implementations must be safe for concurrent use. The in-process
+// MemoryLimiter is the default; a shared backend can implement the same
+// interface so that limits hold across nodes.
+type Limiter interface {
+	// Allow consumes an attempt for key. It returns zero if the attempt may
+	// proceed, or how long the caller has to wait before trying again.
+	Allow(ctx context.Context, key string) (time.Duration, error)
+
+	// RecordFailure registers a failed attempt for key, which may back the
+	// key off or lock it out.
+	RecordFailure(ctx context.Context, key string) error
+
+	// Reset clears the failure history of key after a successful attempt.
+	Reset(ctx context.Context, key string) error
+}
+
+// Config tunes a Limiter.
+type Config struct {
+	// Rate is the number of attempts per second the bucket refills, and
+	// Burst its capacity. Both must be positive.
+	Rate  float64
+	Burst int
+
+	// FreeFailures is how many consecutive failures are tolerated before
+	// backoff starts. Each failure after that blocks the key for BaseDelay,
+	// doubling every time up to MaxDelay.
+	FreeFailures int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+
+	// LockoutThreshold is the number of consecutive failures after which
+	// the key is locked out for LockoutDuration. Further failures while
+	// over the threshold renew the lockout. Zero disables lockout.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+
+	// FailureWindow forgets a key's failures once it has not failed for
+	// this long. Zero keeps them until Reset.
+	FailureWindow time.Duration
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nexus-im/nexus/store/conversation"
+	"github.com/nexus-im/nexus/store/message"
+)
+
+// Receipt statuses carried by receipt_updated.
+const (
+	receiptDelivered = "delivered"
+	receiptRead      = "read"
+)
+
+// markPayload acknowledges every message in a conversation up to and
+// including MessageID.
+type markPayload struct {
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`
+}
+
+type receiptUpdatedPayload struct {
+	ConversationID string                     `json:"conversation_id"`
+	UserID         string                     `json:"user_id"`
+	Status         string                     `json:"status"`
+	MessageID      string                     `json:"message_id"`
+	Counts         *conversation.ReceiptCount `json:"counts"`
+	UpdatedAt      time.Time                  `json:"updated_at"`
+}
+
+func handleMarkDelivered(ctx context.Context, c *Client, raw json.RawMessage) error {
+	return handleMark(ctx, c, raw, receiptDelivered)
+}
+
+func handleMarkRead(ctx context.Context, c *Client, raw json.RawMessage) error {
+	return handleMark(ctx, c, raw, receiptRead)
+}
+
+// handleMark moves the sender's watermark forward and, if it moved, tells
+// the conversation's members how many of them have now got that far.
+func handleMark(ctx context.Context, c *Client, raw json.RawMessage, status string) error {
+	var p markPayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return invalidPayload("malformed " + status + " acknowledgement")
+	}
+	if p.ConversationID == "" {
+		return invalidPayload(errMissingConvo.Error())
+	}
+	if p.MessageID == "" {
+		return invalidPayload("message_id is required")
+	}
+	if !isUUID(p.ConversationID) {
+		return invalidPayload("malformed conversation_id")
+	}
+	if !isUUID(p.MessageID) {
+		return invalidPayload("message not found in this conversation")
+	}
+
+	members, err := conversationStore.ListMemberIDs(ctx, p.ConversationID)
+	if err != nil {
+		return err
+	}
+	if !containsID(members, c.userID) {
+		return unauthorized("not a member of this conversation")
+	}
+
+	msg, err := messageStore.GetByID(ctx, p.MessageID)
+	if err == message.ErrMessageNotFound || (err == nil && msg.ConversationID != p.ConversationID) {
+		return invalidPayload("message not found in this conversation")
+	} else if err != nil {
+		return err
+	}
+
+	var moved bool
+	if status == receiptRead {
+		moved, err = conversationStore.MarkRead(ctx, p.ConversationID, c.userID, p.MessageID)
+	} else {
+		moved, err = conversationStore.MarkDelivered(ctx, p.ConversationID, c.userID, p.MessageID)
+	}
+	if err != nil {
+		return err
+	}
+	if !moved {
+		// Acknowledgements arrive out of order; an older one is a no-op.
+		return nil
+	}
+
+	counts, err := conversationStore.CountReceipts(ctx, p.ConversationID, p.MessageID)
+	if err != nil {
+		return err
+	}
+
+	// The reader's own devices get the update too, so that they can clear
+	// their unread badges.
+	return c.hub.publish(ctx, members, eventReceiptUpdated, &receiptUpdatedPayload{
+		ConversationID: p.ConversationID,
+		UserID:         c.userID,
+		Status:         status,
+		MessageID:      p.MessageID,
+		Counts:         counts,
+		UpdatedAt:      time.Now().UTC(),
+	})
+}
+
+func containsID(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// handleListReceipts serves GET /api/conversations/{id}/receipts, returning
+// every member's delivered and read watermarks.
+func handleListReceipts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conversationID := r.PathValue("id")
+	if !isUUID(conversationID) {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+	ok, err := conversationStore.IsMember(r.Context(), conversationID, userID)
+	if err != nil {
+		log.Printf("Error checking membership: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	receipts, err := conversationStore.ListReceipts(r.Context(), conversationID)
+	if err != nil {
+		log.Printf("Error listing receipts: %v", err)
+		http.Error(w, "Failed to load receipts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"receipts": receipts,
+	})
+}
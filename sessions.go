@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nexus-im/nexus/store/session"
+	"github.com/nexus-im/nexus/store/ticket"
+)
+
+// wsTicketTTL is how long a WebSocket connect ticket stays valid.
+const wsTicketTTL = 30 * time.Second
+
+// handleRefreshToken serves POST /api/token/refresh, rotating a refresh token
+// into a new access/refresh token pair. Replaying an already-rotated refresh
+// token revokes the whole session and disconnects its WebSockets.
+func handleRefreshToken(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := generateSessionToken()
+	if err != nil {
+		http.Error(w, "Failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+	refreshToken, err := generateSessionToken()
+	if err != nil {
+		http.Error(w, "Failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	sess, err := sessionStore.Rotate(r.Context(), req.RefreshToken, token, refreshToken, time.Now().Add(sessionTTL))
+	switch err {
+	case nil:
+	case session.ErrRefreshTokenReused:
+		log.Printf("Refresh token reuse detected for session %s (user %s); session revoked", sess.ID, sess.UserID)
+		hub.revokeSessions([]string{sess.ID})
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	case session.ErrRefreshTokenNotFound, session.ErrSessionExpired:
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	default:
+		log.Printf("Error rotating refresh token: %v", err)
+		http.Error(w, "Failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	writeSessionTokens(w, sess)
+}
+
+// handleLogout revokes the session used to make the request.
+func handleLogout(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sess, err := authenticateSession(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := sessionStore.Delete(r.Context(), sess.UserID, sess.ID); err != nil && err != session.ErrSessionNotFound {
+		log.Printf("Error revoking session: %v", err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+	hub.revokeSessions([]string{sess.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSessions serves /api/sessions, dispatching on method.
+func handleSessions(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleListSessions(w, r)
+	case http.MethodDelete:
+		handleRevokeAllSessions(hub, w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// sessionView is a session as listed to its owner.
+type sessionView struct {
+	*session.Session
+	Current bool `json:"current"`
+}
+
+// handleListSessions returns the caller's active sessions with device
+// metadata, flagging the one used for this request.
+func handleListSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, err := authenticateSession(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := sessionStore.ListByUser(r.Context(), current.UserID)
+	if err != nil {
+		log.Printf("Error listing sessions: %v", err)
+		http.Error(w, "Failed to load sessions", http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]sessionView, 0, len(sessions))
+	for _, sess := range sessions {
+		views = append(views, sessionView{Session: sess, Current: sess.ID == current.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": views,
+	})
+}
+
+// handleRevokeAllSessions logs the caller out everywhere, including the
+// session used to make the request.
+func handleRevokeAllSessions(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ids, err := sessionStore.DeleteByUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	hub.revokeSessions(ids)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRevokeSession serves DELETE /api/sessions/{id}. Users may only revoke
+// their own sessions.
+func handleRevokeSession(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := sessionStore.Delete(r.Context(), userID, id); err != nil {
+		if err == session.ErrSessionNotFound {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error revoking session: %v", err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	hub.revokeSessions([]string{id})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreateWsTicket serves POST /api/ws-ticket, minting a single-use
+// ticket so clients need not put their session token in the /ws URL.
+func handleCreateWsTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sess, err := authenticateSession(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	value, err := generateSessionToken()
+	if err != nil {
+		http.Error(w, "Failed to create ticket", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	t := &ticket.Ticket{
+		Value:     value,
+		SessionID: sess.ID,
+		UserID:    sess.UserID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(wsTicketTTL),
+	}
+	if err := ticketStore.Create(r.Context(), t); err != nil {
+		log.Printf("Error creating ws ticket: %v", err)
+		http.Error(w, "Failed to create ticket", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"ticket":     value,
+		"expires_in": int(wsTicketTTL.Seconds()),
+	})
+}
@@ -19,15 +19,136 @@ type Conversation struct {
 	Type      Type      `json:"type"`
 	CreatedBy string    `json:"created_by"`
 	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Topic     string    `json:"topic"`
+	AvatarURL string    `json:"avatar_url"`
+}
+
+// MetadataUpdate is a partial update of a conversation's display metadata.
+// Nil fields are left unchanged.
+type MetadataUpdate struct {
+	Name      *string
+	Topic     *string
+	AvatarURL *string
+}
+
+// Member is a user's membership in a conversation.
+type Member struct {
+	UserID   string    `json:"user_id"`
+	Role     Role      `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// MessagePreview is a short view of the latest message in a conversation.
+type MessagePreview struct {
+	ID        string    `json:"id"`
+	SenderID  string    `json:"sender_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	// DeletedAt is set if the message was deleted for everyone, in which
+	// case Content is empty.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Summary is a conversation as it appears in a member's inbox.
+type Summary struct {
+	Conversation
+	Members     []Member        `json:"members"`
+	LastMessage *MessagePreview `json:"last_message"`
+	UnreadCount int             `json:"unread_count"`
+}
+
+// Watermark marks how far a member has got through a conversation: every
+// message up to and including MessageID is covered.
+type Watermark struct {
+	MessageID string    `json:"message_id"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+// Receipt holds a member's delivered and read watermarks. Either is nil if
+// the member has not acknowledged any message yet. Reading a message implies
+// it was delivered, so Delivered is never behind Read.
+type Receipt struct {
+	UserID    string     `json:"user_id"`
+	Delivered *Watermark `json:"delivered"`
+	Read      *Watermark `json:"read"`
+}
+
+// ReceiptCount aggregates receipts for one message over the members other
+// than its sender.
+type ReceiptCount struct {
+	Delivered int `json:"delivered"`
+	Read      int `json:"read"`
+	Members   int `json:"members"`
 }
 
 var (
 	ErrConversationNotFound = errors.New("conversation not found")
+	ErrNotMember            = errors.New("user is not a member of the conversation")
 )
 
 // Store defines conversation persistence operations.
 type Store interface {
+	GetByID(ctx context.Context, id string) (*Conversation, error)
 	GetP2PBetween(ctx context.Context, userAID, userBID string) (*Conversation, error)
 	GetSelfP2P(ctx context.Context, userID string) (*Conversation, error)
+
+	// CreateConversation inserts convo and its members. For groups the
+	// creator becomes the owner; everyone else joins as a member.
 	CreateConversation(ctx context.Context, convo *Conversation, memberIDs []string) error
+
+	// DeleteConversation removes a conversation with its members and
+	// messages.
+	DeleteConversation(ctx context.Context, id string) error
+
+	IsMember(ctx context.Context, conversationID, userID string) (bool, error)
+	ListMemberIDs(ctx context.Context, conversationID string) ([]string, error)
+	ListMembers(ctx context.Context, conversationID string) ([]Member, error)
+
+	// ListContactIDs returns every other user who shares at least one
+	// conversation with userID.
+	ListContactIDs(ctx context.Context, userID string) ([]string, error)
+
+	// GetMember returns userID's membership, or ErrNotMember.
+	GetMember(ctx context.Context, conversationID, userID string) (*Member, error)
+
+	// SetRole changes a member's role. It returns ErrNotMember if the user
+	// is not a member.
+	SetRole(ctx context.Context, conversationID, userID string, role Role) error
+
+	// UpdateMetadata applies update and returns the updated conversation.
+	UpdateMetadata(ctx context.Context, id string, update MetadataUpdate) (*Conversation, error)
+
+	// TransferOwnership makes toID the owner and demotes fromID to admin.
+	TransferOwnership(ctx context.Context, conversationID, fromID, toID string) error
+
+	// AddMembers adds userIDs to a conversation, skipping existing members,
+	// and returns the IDs that were actually added.
+	AddMembers(ctx context.Context, conversationID string, userIDs []string) ([]string, error)
+
+	// RemoveMember removes userID from a conversation. It returns
+	// ErrNotMember if the user was not a member.
+	RemoveMember(ctx context.Context, conversationID, userID string) error
+
+	// ListForUser returns every conversation userID belongs to, most
+	// recently active first.
+	ListForUser(ctx context.Context, userID string) ([]*Summary, error)
+
+	// MarkDelivered moves userID's delivered watermark forward to
+	// messageID. It reports false if the watermark was already at or past
+	// the message.
+	MarkDelivered(ctx context.Context, conversationID, userID, messageID string) (bool, error)
+
+	// MarkRead moves userID's read watermark, and the delivered watermark
+	// with it, forward to messageID. It reports false if the read watermark
+	// was already at or past the message.
+	MarkRead(ctx context.Context, conversationID, userID, messageID string) (bool, error)
+
+	// ListReceipts returns the watermarks of every member of a
+	// conversation.
+	ListReceipts(ctx context.Context, conversationID string) ([]Receipt, error)
+
+	// CountReceipts counts the members other than the sender who have had
+	// messageID delivered and who have read it.
+	CountReceipts(ctx context.Context, conversationID, messageID string) (*ReceiptCount, error)
 }
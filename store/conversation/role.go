@@ -0,0 +1,66 @@
+package conversation
+
+// Role is a member's rank within a group conversation.
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+)
+
+// Permission is a group-mutating action gated by role.
+type Permission string
+
+const (
+	PermAddMembers    Permission = "add_members"
+	PermRemoveMembers Permission = "remove_members"
+	PermRename        Permission = "rename"
+	PermManageRoles   Permission = "manage_roles"
+	PermDelete        Permission = "delete"
+
+	// PermDeleteMessages allows deleting other members' messages for
+	// everyone.
+	PermDeleteMessages Permission = "delete_messages"
+)
+
+var rolePermissions = map[Role]map[Permission]bool{
+	RoleOwner: {
+		PermAddMembers:     true,
+		PermRemoveMembers:  true,
+		PermRename:         true,
+		PermManageRoles:    true,
+		PermDelete:         true,
+		PermDeleteMessages: true,
+	},
+	RoleAdmin: {
+		PermAddMembers:     true,
+		PermRemoveMembers:  true,
+		PermRename:         true,
+		PermDeleteMessages: true,
+	},
+	RoleMember: {},
+}
+
+var roleRank = map[Role]int{
+	RoleMember: 1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Can reports whether a member with role r may perform p.
+func (r Role) Can(p Permission) bool {
+	return rolePermissions[r][p]
+}
+
+// Outranks reports whether r is strictly higher than other. Members may only
+// act on (e.g. remove) members they outrank.
+func (r Role) Outranks(other Role) bool {
+	return roleRank[r] > roleRank[other]
+}
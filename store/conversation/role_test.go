@@ -0,0 +1,44 @@
+package conversation
+
+import "testing"
+
+func TestRoleCan(t *testing.T) {
+	tests := []struct {
+		role Role
+		perm Permission
+		want bool
+	}{
+		{RoleOwner, PermDelete, true},
+		{RoleOwner, PermManageRoles, true},
+		{RoleAdmin, PermAddMembers, true},
+		{RoleAdmin, PermRename, true},
+		{RoleAdmin, PermDelete, false},
+		{RoleAdmin, PermManageRoles, false},
+		{RoleAdmin, PermDeleteMessages, true},
+		{RoleMember, PermDeleteMessages, false},
+		{RoleMember, PermAddMembers, false},
+		{RoleMember, PermRename, false},
+		{Role("bogus"), PermAddMembers, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.Can(tt.perm); got != tt.want {
+			t.Errorf("%s.Can(%s) = %v, want %v", tt.role, tt.perm, got, tt.want)
+		}
+	}
+}
+
+func TestRoleOutranks(t *testing.T) {
+	if !RoleOwner.Outranks(RoleAdmin) {
+		t.Errorf("expected owner to outrank admin")
+	}
+	if !RoleAdmin.Outranks(RoleMember) {
+		t.Errorf("expected admin to outrank member")
+	}
+	if RoleAdmin.Outranks(RoleAdmin) {
+		t.Errorf("expected admin not to outrank admin")
+	}
+	if RoleMember.Outranks(RoleOwner) {
+		t.Errorf("expected member not to outrank owner")
+	}
+}
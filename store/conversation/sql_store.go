@@ -16,9 +16,25 @@ func NewSQLStore(db *sql.DB) *SQLStore {
 	return &SQLStore{db: db}
 }
 
+func (s *SQLStore) GetByID(ctx context.Context, id string) (*Conversation, error) {
+	query := `SELECT id, type, created_by, created_at, name, topic, avatar_url FROM conversations WHERE id = $1`
+
+	row := s.db.QueryRowContext(ctx, query, id)
+
+	var convo Conversation
+	if err := row.Scan(&convo.ID, &convo.Type, &convo.CreatedBy, &convo.CreatedAt, &convo.Name, &convo.Topic, &convo.AvatarURL); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+
+	return &convo, nil
+}
+
 func (s *SQLStore) GetP2PBetween(ctx context.Context, userAID, userBID string) (*Conversation, error) {
 	query := `
-		SELECT c.id, c.type, c.created_by, c.created_at
+		SELECT c.id, c.type, c.created_by, c.created_at, c.name, c.topic, c.avatar_url
 		FROM conversations c
 		JOIN conversation_members m1 ON m1.conversation_id = c.id
 		JOIN conversation_members m2 ON m2.conversation_id = c.id
@@ -31,7 +47,7 @@ func (s *SQLStore) GetP2PBetween(ctx context.Context, userAID, userBID string) (
 	row := s.db.QueryRowContext(ctx, query, userAID, userBID)
 
 	var convo Conversation
-	if err := row.Scan(&convo.ID, &convo.Type, &convo.CreatedBy, &convo.CreatedAt); err != nil {
+	if err := row.Scan(&convo.ID, &convo.Type, &convo.CreatedBy, &convo.CreatedAt, &convo.Name, &convo.Topic, &convo.AvatarURL); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrConversationNotFound
 		}
@@ -43,7 +59,7 @@ func (s *SQLStore) GetP2PBetween(ctx context.Context, userAID, userBID string) (
 
 func (s *SQLStore) GetSelfP2P(ctx context.Context, userID string) (*Conversation, error) {
 	query := `
-		SELECT c.id, c.type, c.created_by, c.created_at
+		SELECT c.id, c.type, c.created_by, c.created_at, c.name, c.topic, c.avatar_url
 		FROM conversations c
 		JOIN conversation_members m ON m.conversation_id = c.id
 		WHERE c.type = 'p2p' AND m.user_id = $1
@@ -55,7 +71,7 @@ func (s *SQLStore) GetSelfP2P(ctx context.Context, userID string) (*Conversation
 	row := s.db.QueryRowContext(ctx, query, userID)
 
 	var convo Conversation
-	if err := row.Scan(&convo.ID, &convo.Type, &convo.CreatedBy, &convo.CreatedAt); err != nil {
+	if err := row.Scan(&convo.ID, &convo.Type, &convo.CreatedBy, &convo.CreatedAt, &convo.Name, &convo.Topic, &convo.AvatarURL); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrConversationNotFound
 		}
@@ -83,23 +99,34 @@ func (s *SQLStore) CreateConversation(ctx context.Context, convo *Conversation,
 	}
 
 	convoInsert := `
-		INSERT INTO conversations (type, created_by, created_at)
-		VALUES ($1, $2, $3)
+		INSERT INTO conversations (type, created_by, created_at, name, topic, avatar_url)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id
 	`
 
-	if err = tx.QueryRowContext(ctx, convoInsert, convo.Type, convo.CreatedBy, convo.CreatedAt).Scan(&convo.ID); err != nil {
+	if err = tx.QueryRowContext(ctx, convoInsert,
+		convo.Type,
+		convo.CreatedBy,
+		convo.CreatedAt,
+		convo.Name,
+		convo.Topic,
+		convo.AvatarURL,
+	).Scan(&convo.ID); err != nil {
 		return err
 	}
 
 	memberInsert := `
-		INSERT INTO conversation_members (conversation_id, user_id, joined_at)
-		VALUES ($1, $2, $3)
+		INSERT INTO conversation_members (conversation_id, user_id, role, joined_at)
+		VALUES ($1, $2, $3, $4)
 	`
 
 	joinedAt := time.Now()
 	for _, memberID := range memberIDs {
-		if _, err = tx.ExecContext(ctx, memberInsert, convo.ID, memberID, joinedAt); err != nil {
+		role := RoleMember
+		if convo.Type == TypeGroup && memberID == convo.CreatedBy {
+			role = RoleOwner
+		}
+		if _, err = tx.ExecContext(ctx, memberInsert, convo.ID, memberID, role, joinedAt); err != nil {
 			return err
 		}
 	}
@@ -110,3 +137,488 @@ func (s *SQLStore) CreateConversation(ctx context.Context, convo *Conversation,
 
 	return nil
 }
+
+func (s *SQLStore) IsMember(ctx context.Context, conversationID, userID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM conversation_members WHERE conversation_id = $1 AND user_id = $2)`
+
+	var ok bool
+	if err := s.db.QueryRowContext(ctx, query, conversationID, userID).Scan(&ok); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+func (s *SQLStore) ListMemberIDs(ctx context.Context, conversationID string) ([]string, error) {
+	query := `SELECT user_id FROM conversation_members WHERE conversation_id = $1`
+
+	return s.listIDs(ctx, query, conversationID)
+}
+
+func (s *SQLStore) ListContactIDs(ctx context.Context, userID string) ([]string, error) {
+	query := `
+		SELECT DISTINCT other.user_id
+		FROM conversation_members me
+		JOIN conversation_members other ON other.conversation_id = me.conversation_id
+		WHERE me.user_id = $1 AND other.user_id <> $1
+	`
+
+	return s.listIDs(ctx, query, userID)
+}
+
+// listIDs runs a query returning a single ID column and collects the IDs.
+func (s *SQLStore) listIDs(ctx context.Context, query string, arg interface{}) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (s *SQLStore) ListMembers(ctx context.Context, conversationID string) ([]Member, error) {
+	query := `
+		SELECT user_id, role, joined_at
+		FROM conversation_members
+		WHERE conversation_id = $1
+		ORDER BY joined_at, user_id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var members []Member
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.UserID, &m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func (s *SQLStore) ListForUser(ctx context.Context, userID string) ([]*Summary, error) {
+	// Unread messages are those from other members after the caller's read
+	// watermark, or since they joined if they have not read anything.
+	// Messages are ordered by (created_at, id), as in the history. Deleted
+	// messages are not counted, and messages the caller deleted for
+	// themselves are neither counted nor previewed.
+	query := `
+		SELECT c.id, c.type, c.created_by, c.created_at, c.name, c.topic, c.avatar_url,
+			lm.id, lm.sender_id, lm.content, lm.created_at, lm.deleted_at,
+			(
+				SELECT COUNT(*)
+				FROM messages um
+				WHERE um.conversation_id = c.id
+					AND um.sender_id <> $1
+					AND um.deleted_at IS NULL
+					AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = um.id AND h.user_id = $1)
+					AND CASE
+						WHEN me.last_read_message_id IS NULL THEN um.created_at > me.joined_at
+						ELSE (um.created_at, um.id) > (me.last_read_at, me.last_read_message_id)
+					END
+			) AS unread_count
+		FROM conversation_members me
+		JOIN conversations c ON c.id = me.conversation_id
+		LEFT JOIN LATERAL (
+			SELECT id, sender_id, content, created_at, deleted_at
+			FROM messages
+			WHERE conversation_id = c.id
+				AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = messages.id AND h.user_id = $1)
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		) lm ON true
+		WHERE me.user_id = $1
+		ORDER BY COALESCE(lm.created_at, c.created_at) DESC, c.id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	summaries := []*Summary{}
+	byID := make(map[string]*Summary)
+	for rows.Next() {
+		var (
+			sum                             Summary
+			lastID, lastSender, lastContent sql.NullString
+			lastCreatedAt, lastDeletedAt    sql.NullTime
+		)
+		if err := rows.Scan(
+			&sum.ID, &sum.Type, &sum.CreatedBy, &sum.CreatedAt, &sum.Name, &sum.Topic, &sum.AvatarURL,
+			&lastID, &lastSender, &lastContent, &lastCreatedAt, &lastDeletedAt,
+			&sum.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+		if lastID.Valid {
+			sum.LastMessage = &MessagePreview{
+				ID:        lastID.String,
+				SenderID:  lastSender.String,
+				Content:   lastContent.String,
+				CreatedAt: lastCreatedAt.Time,
+			}
+			if lastDeletedAt.Valid {
+				sum.LastMessage.DeletedAt = &lastDeletedAt.Time
+			}
+		}
+		summaries = append(summaries, &sum)
+		byID[sum.ID] = &sum
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(summaries) == 0 {
+		return summaries, nil
+	}
+
+	memberQuery := `
+		SELECT m.conversation_id, m.user_id, m.role, m.joined_at
+		FROM conversation_members m
+		JOIN conversation_members me ON me.conversation_id = m.conversation_id
+		WHERE me.user_id = $1
+		ORDER BY m.joined_at, m.user_id
+	`
+
+	memberRows, err := s.db.QueryContext(ctx, memberQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = memberRows.Close()
+	}()
+
+	for memberRows.Next() {
+		var (
+			conversationID string
+			m              Member
+		)
+		if err := memberRows.Scan(&conversationID, &m.UserID, &m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		if sum, ok := byID[conversationID]; ok {
+			sum.Members = append(sum.Members, m)
+		}
+	}
+	if err := memberRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+func (s *SQLStore) AddMembers(ctx context.Context, conversationID string, userIDs []string) (added []string, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	memberInsert := `
+		INSERT INTO conversation_members (conversation_id, user_id, role, joined_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (conversation_id, user_id) DO NOTHING
+	`
+
+	joinedAt := time.Now()
+	for _, userID := range userIDs {
+		var result sql.Result
+		result, err = tx.ExecContext(ctx, memberInsert, conversationID, userID, RoleMember, joinedAt)
+		if err != nil {
+			return nil, err
+		}
+		var rows int64
+		rows, err = result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if rows > 0 {
+			added = append(added, userID)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+func (s *SQLStore) RemoveMember(ctx context.Context, conversationID, userID string) error {
+	query := `DELETE FROM conversation_members WHERE conversation_id = $1 AND user_id = $2`
+
+	result, err := s.db.ExecContext(ctx, query, conversationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotMember
+	}
+
+	return nil
+}
+
+func (s *SQLStore) DeleteConversation(ctx context.Context, id string) error {
+	query := `DELETE FROM conversations WHERE id = $1`
+
+	result, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrConversationNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLStore) GetMember(ctx context.Context, conversationID, userID string) (*Member, error) {
+	query := `SELECT user_id, role, joined_at FROM conversation_members WHERE conversation_id = $1 AND user_id = $2`
+
+	var m Member
+	err := s.db.QueryRowContext(ctx, query, conversationID, userID).Scan(&m.UserID, &m.Role, &m.JoinedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotMember
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func (s *SQLStore) SetRole(ctx context.Context, conversationID, userID string, role Role) error {
+	query := `UPDATE conversation_members SET role = $1 WHERE conversation_id = $2 AND user_id = $3`
+
+	result, err := s.db.ExecContext(ctx, query, role, conversationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotMember
+	}
+
+	return nil
+}
+
+func (s *SQLStore) TransferOwnership(ctx context.Context, conversationID, fromID, toID string) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Demote first: at most one owner per conversation is enforced by a
+	// unique index.
+	query := `UPDATE conversation_members SET role = $1 WHERE conversation_id = $2 AND user_id = $3`
+
+	for _, change := range []struct {
+		userID string
+		role   Role
+	}{
+		{fromID, RoleAdmin},
+		{toID, RoleOwner},
+	} {
+		var result sql.Result
+		result, err = tx.ExecContext(ctx, query, change.role, conversationID, change.userID)
+		if err != nil {
+			return err
+		}
+		var rows int64
+		rows, err = result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			err = ErrNotMember
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) UpdateMetadata(ctx context.Context, id string, update MetadataUpdate) (*Conversation, error) {
+	query := `
+		UPDATE conversations
+		SET name = COALESCE($2, name),
+			topic = COALESCE($3, topic),
+			avatar_url = COALESCE($4, avatar_url)
+		WHERE id = $1
+		RETURNING id, type, created_by, created_at, name, topic, avatar_url
+	`
+
+	row := s.db.QueryRowContext(ctx, query, id, update.Name, update.Topic, update.AvatarURL)
+
+	var convo Conversation
+	if err := row.Scan(&convo.ID, &convo.Type, &convo.CreatedBy, &convo.CreatedAt, &convo.Name, &convo.Topic, &convo.AvatarURL); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+
+	return &convo, nil
+}
+
+func (s *SQLStore) MarkDelivered(ctx context.Context, conversationID, userID, messageID string) (bool, error) {
+	query := `
+		UPDATE conversation_members me
+		SET last_delivered_message_id = m.id, last_delivered_at = m.created_at
+		FROM messages m
+		WHERE me.conversation_id = $1 AND me.user_id = $2
+			AND m.id = $3 AND m.conversation_id = me.conversation_id
+			AND (me.last_delivered_message_id IS NULL
+				OR (me.last_delivered_at, me.last_delivered_message_id) < (m.created_at, m.id))
+	`
+
+	return s.advance(ctx, query, conversationID, userID, messageID)
+}
+
+func (s *SQLStore) MarkRead(ctx context.Context, conversationID, userID, messageID string) (bool, error) {
+	query := `
+		UPDATE conversation_members me
+		SET last_read_message_id = m.id, last_read_at = m.created_at,
+			last_delivered_message_id = CASE
+				WHEN me.last_delivered_message_id IS NULL
+					OR (me.last_delivered_at, me.last_delivered_message_id) < (m.created_at, m.id)
+				THEN m.id ELSE me.last_delivered_message_id END,
+			last_delivered_at = GREATEST(me.last_delivered_at, m.created_at)
+		FROM messages m
+		WHERE me.conversation_id = $1 AND me.user_id = $2
+			AND m.id = $3 AND m.conversation_id = me.conversation_id
+			AND (me.last_read_message_id IS NULL
+				OR (me.last_read_at, me.last_read_message_id) < (m.created_at, m.id))
+	`
+
+	return s.advance(ctx, query, conversationID, userID, messageID)
+}
+
+// advance runs a watermark update and reports whether it moved anything.
+func (s *SQLStore) advance(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func (s *SQLStore) ListReceipts(ctx context.Context, conversationID string) ([]Receipt, error) {
+	query := `
+		SELECT user_id, last_delivered_message_id, last_delivered_at, last_read_message_id, last_read_at
+		FROM conversation_members
+		WHERE conversation_id = $1
+		ORDER BY joined_at, user_id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	receipts := []Receipt{}
+	for rows.Next() {
+		var (
+			r                   Receipt
+			deliveredID, readID sql.NullString
+			deliveredAt, readAt sql.NullTime
+		)
+		if err := rows.Scan(&r.UserID, &deliveredID, &deliveredAt, &readID, &readAt); err != nil {
+			return nil, err
+		}
+		if deliveredID.Valid {
+			r.Delivered = &Watermark{MessageID: deliveredID.String, SentAt: deliveredAt.Time}
+		}
+		if readID.Valid {
+			r.Read = &Watermark{MessageID: readID.String, SentAt: readAt.Time}
+		}
+		receipts = append(receipts, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return receipts, nil
+}
+
+func (s *SQLStore) CountReceipts(ctx context.Context, conversationID, messageID string) (*ReceiptCount, error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE me.last_delivered_message_id IS NOT NULL
+				AND (me.last_delivered_at, me.last_delivered_message_id) >= (m.created_at, m.id)),
+			COUNT(*) FILTER (WHERE me.last_read_message_id IS NOT NULL
+				AND (me.last_read_at, me.last_read_message_id) >= (m.created_at, m.id)),
+			COUNT(*)
+		FROM messages m
+		JOIN conversation_members me ON me.conversation_id = m.conversation_id
+		WHERE m.id = $2 AND m.conversation_id = $1 AND me.user_id <> m.sender_id
+	`
+
+	var c ReceiptCount
+	if err := s.db.QueryRowContext(ctx, query, conversationID, messageID).Scan(&c.Delivered, &c.Read, &c.Members); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
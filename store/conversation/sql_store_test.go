@@ -0,0 +1,593 @@
+package conversation
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestIsMember(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM conversation_members WHERE conversation_id = $1 AND user_id = $2)`)).
+		WithArgs("convo-1", "user-123").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	ok, err := store.IsMember(ctx, "convo-1", "user-123")
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if !ok {
+		t.Errorf("expected user-123 to be a member")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListMemberIDs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id FROM conversation_members WHERE conversation_id = $1`)).
+		WithArgs("convo-1").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("user-1").AddRow("user-2"))
+
+	ids, err := store.ListMemberIDs(ctx, "convo-1")
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if len(ids) != 2 || ids[0] != "user-1" || ids[1] != "user-2" {
+		t.Errorf("unexpected member ids: %v", ids)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListContactIDs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT other.user_id FROM conversation_members me JOIN conversation_members other ON other.conversation_id = me.conversation_id WHERE me.user_id = $1 AND other.user_id <> $1`)).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("user-2").AddRow("user-3"))
+
+	ids, err := store.ListContactIDs(ctx, "user-1")
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if len(ids) != 2 || ids[0] != "user-2" || ids[1] != "user-3" {
+		t.Errorf("unexpected contact ids: %v", ids)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM conversation_members me JOIN conversations c ON c.id = me.conversation_id`)).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "type", "created_by", "created_at", "name", "topic", "avatar_url",
+			"id", "sender_id", "content", "created_at", "deleted_at", "unread_count",
+		}).
+			AddRow("convo-1", "group", "user-1", fixedTime, "Team", "", "", "message-1", "user-2", "hi", fixedTime.Add(time.Hour), nil, 3).
+			AddRow("convo-2", "p2p", "user-1", fixedTime, "", "", "", nil, nil, nil, nil, nil, 0))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT m.conversation_id, m.user_id, m.role, m.joined_at FROM conversation_members m`)).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id", "role", "joined_at"}).
+			AddRow("convo-1", "user-1", "owner", fixedTime).
+			AddRow("convo-2", "user-1", "member", fixedTime).
+			AddRow("convo-1", "user-2", "member", fixedTime))
+
+	summaries, err := store.ListForUser(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("expected 2 summaries, got %d", len(summaries))
+	}
+
+	first := summaries[0]
+	if first.ID != "convo-1" || first.UnreadCount != 3 {
+		t.Errorf("unexpected first summary: %+v", first)
+	}
+	if first.LastMessage == nil || first.LastMessage.ID != "message-1" {
+		t.Errorf("expected last message message-1, got %+v", first.LastMessage)
+	}
+	if len(first.Members) != 2 {
+		t.Errorf("expected 2 members, got %d", len(first.Members))
+	} else if first.Members[0].Role != RoleOwner {
+		t.Errorf("expected first member to be owner, got %s", first.Members[0].Role)
+	}
+
+	second := summaries[1]
+	if second.LastMessage != nil {
+		t.Errorf("expected no last message, got %+v", second.LastMessage)
+	}
+	if len(second.Members) != 1 {
+		t.Errorf("expected 1 member, got %d", len(second.Members))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Success Case
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, type, created_by, created_at, name, topic, avatar_url FROM conversations WHERE id = $1`)).
+		WithArgs("convo-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "created_by", "created_at", "name", "topic", "avatar_url"}).
+			AddRow("convo-1", "group", "user-1", fixedTime, "Team", "", ""))
+
+	convo, err := store.GetByID(ctx, "convo-1")
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if convo == nil || convo.Type != TypeGroup || convo.Name != "Team" {
+		t.Errorf("expected group conversation named Team, got %+v", convo)
+	}
+
+	// Not Found Case
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, type, created_by, created_at, name, topic, avatar_url FROM conversations WHERE id = $1`)).
+		WithArgs("unknown").
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = store.GetByID(ctx, "unknown")
+	if err != ErrConversationNotFound {
+		t.Errorf("expected ErrConversationNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAddMembers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	insert := regexp.QuoteMeta(`INSERT INTO conversation_members (conversation_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4) ON CONFLICT (conversation_id, user_id) DO NOTHING`)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insert).
+		WithArgs("convo-1", "user-2", RoleMember, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insert).
+		WithArgs("convo-1", "user-3", RoleMember, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	added, err := store.AddMembers(ctx, "convo-1", []string{"user-2", "user-3"})
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if len(added) != 1 || added[0] != "user-2" {
+		t.Errorf("expected [user-2] to be added, got %v", added)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRemoveMember(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	query := regexp.QuoteMeta(`DELETE FROM conversation_members WHERE conversation_id = $1 AND user_id = $2`)
+
+	// Success Case
+	mock.ExpectExec(query).
+		WithArgs("convo-1", "user-2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.RemoveMember(ctx, "convo-1", "user-2"); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	// Not A Member Case
+	mock.ExpectExec(query).
+		WithArgs("convo-1", "user-9").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.RemoveMember(ctx, "convo-1", "user-9"); err != ErrNotMember {
+		t.Errorf("expected ErrNotMember, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateConversationAssignsOwner(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	convo := &Conversation{Type: TypeGroup, CreatedBy: "user-1", CreatedAt: fixedTime, Name: "Team"}
+	insert := regexp.QuoteMeta(`INSERT INTO conversation_members (conversation_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO conversations (type, created_by, created_at, name, topic, avatar_url) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`)).
+		WithArgs(TypeGroup, "user-1", fixedTime, "Team", "", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("convo-1"))
+	mock.ExpectExec(insert).
+		WithArgs("convo-1", "user-1", RoleOwner, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insert).
+		WithArgs("convo-1", "user-2", RoleMember, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := store.CreateConversation(ctx, convo, []string{"user-1", "user-2"}); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if convo.ID != "convo-1" {
+		t.Errorf("expected id convo-1, got %s", convo.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetMember(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	query := regexp.QuoteMeta(`SELECT user_id, role, joined_at FROM conversation_members WHERE conversation_id = $1 AND user_id = $2`)
+
+	// Success Case
+	mock.ExpectQuery(query).
+		WithArgs("convo-1", "user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "role", "joined_at"}).AddRow("user-1", "admin", fixedTime))
+
+	m, err := store.GetMember(ctx, "convo-1", "user-1")
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if m == nil || m.Role != RoleAdmin {
+		t.Errorf("expected admin member, got %+v", m)
+	}
+
+	// Not A Member Case
+	mock.ExpectQuery(query).
+		WithArgs("convo-1", "user-9").
+		WillReturnError(sql.ErrNoRows)
+
+	if _, err := store.GetMember(ctx, "convo-1", "user-9"); err != ErrNotMember {
+		t.Errorf("expected ErrNotMember, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestTransferOwnership(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	update := regexp.QuoteMeta(`UPDATE conversation_members SET role = $1 WHERE conversation_id = $2 AND user_id = $3`)
+
+	// Success Case: demote then promote.
+	mock.ExpectBegin()
+	mock.ExpectExec(update).WithArgs(RoleAdmin, "convo-1", "user-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(update).WithArgs(RoleOwner, "convo-1", "user-2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := store.TransferOwnership(ctx, "convo-1", "user-1", "user-2"); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	// Target Not A Member Case rolls back.
+	mock.ExpectBegin()
+	mock.ExpectExec(update).WithArgs(RoleAdmin, "convo-1", "user-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(update).WithArgs(RoleOwner, "convo-1", "user-9").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	if err := store.TransferOwnership(ctx, "convo-1", "user-1", "user-9"); err != ErrNotMember {
+		t.Errorf("expected ErrNotMember, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	name := "Renamed"
+
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE conversations SET name = COALESCE($2, name), topic = COALESCE($3, topic), avatar_url = COALESCE($4, avatar_url) WHERE id = $1`)).
+		WithArgs("convo-1", &name, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "created_by", "created_at", "name", "topic", "avatar_url"}).
+			AddRow("convo-1", "group", "user-1", fixedTime, name, "old topic", ""))
+
+	convo, err := store.UpdateMetadata(ctx, "convo-1", MetadataUpdate{Name: &name})
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if convo == nil || convo.Name != name || convo.Topic != "old topic" {
+		t.Errorf("unexpected conversation: %+v", convo)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMarkRead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE conversation_members me SET last_read_message_id = m.id, last_read_at = m.created_at`)).
+		WithArgs("convo-1", "user-1", "message-2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	moved, err := store.MarkRead(ctx, "convo-1", "user-1", "message-2")
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if !moved {
+		t.Errorf("expected the read watermark to move")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMarkDeliveredStale(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE conversation_members me SET last_delivered_message_id = m.id, last_delivered_at = m.created_at`)).
+		WithArgs("convo-1", "user-1", "message-1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	moved, err := store.MarkDelivered(ctx, "convo-1", "user-1", "message-1")
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if moved {
+		t.Errorf("expected an older acknowledgement not to move the watermark")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListReceipts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id, last_delivered_message_id, last_delivered_at, last_read_message_id, last_read_at FROM conversation_members`)).
+		WithArgs("convo-1").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"user_id", "last_delivered_message_id", "last_delivered_at", "last_read_message_id", "last_read_at",
+		}).
+			AddRow("user-1", "message-2", fixedTime, "message-1", fixedTime.Add(-time.Minute)).
+			AddRow("user-2", nil, nil, nil, nil))
+
+	receipts, err := store.ListReceipts(ctx, "convo-1")
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if len(receipts) != 2 {
+		t.Fatalf("expected 2 receipts, got %d", len(receipts))
+	}
+	if receipts[0].Delivered == nil || receipts[0].Delivered.MessageID != "message-2" {
+		t.Errorf("unexpected delivered watermark: %+v", receipts[0].Delivered)
+	}
+	if receipts[0].Read == nil || receipts[0].Read.MessageID != "message-1" {
+		t.Errorf("unexpected read watermark: %+v", receipts[0].Read)
+	}
+	if receipts[1].Delivered != nil || receipts[1].Read != nil {
+		t.Errorf("expected no watermarks for user-2, got %+v", receipts[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCountReceipts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM messages m JOIN conversation_members me ON me.conversation_id = m.conversation_id`)).
+		WithArgs("convo-1", "message-1").
+		WillReturnRows(sqlmock.NewRows([]string{"delivered", "read", "members"}).AddRow(4, 3, 5))
+
+	counts, err := store.CountReceipts(ctx, "convo-1", "message-1")
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if *counts != (ReceiptCount{Delivered: 4, Read: 3, Members: 5}) {
+		t.Errorf("unexpected counts: %+v", counts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
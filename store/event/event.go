@@ -0,0 +1,37 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Event is one entry in a user's event stream. Sequence numbers start at 1
+// and increase by one for every event stored for the user.
+type Event struct {
+	UserID    string          `json:"user_id"`
+	Seq       int64           `json:"seq"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Store defines persistence for per-user event streams.
+type Store interface {
+	// Append stores an event in the stream of each of userIDs and returns
+	// the sequence number it was given in each stream.
+	Append(ctx context.Context, userIDs []string, eventType string, payload json.RawMessage) (map[string]int64, error)
+
+	// LastSeq returns the sequence number of userID's latest event, or 0 if
+	// they have never had one.
+	LastSeq(ctx context.Context, userID string) (int64, error)
+
+	// ListSince returns up to limit of userID's events after since, oldest
+	// first.
+	ListSince(ctx context.Context, userID string, since int64, limit int) ([]*Event, error)
+
+	// DeleteBefore purges up to limit events created before the given time
+	// and returns how many rows were removed. Sequence counters are kept,
+	// so numbering never restarts.
+	DeleteBefore(ctx context.Context, before time.Time, limit int) (int64, error)
+}
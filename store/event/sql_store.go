@@ -0,0 +1,139 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// SQLStore implements Store using a database/sql connection.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a new SQLStore.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) Append(ctx context.Context, userIDs []string, eventType string, payload json.RawMessage) (seqs map[string]int64, err error) {
+	// Counters are locked in a fixed order so that concurrent appends to
+	// overlapping sets of users cannot deadlock.
+	ids := make([]string, 0, len(userIDs))
+	seen := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	nextSeq := `
+		INSERT INTO user_event_seqs (user_id, last_seq)
+		VALUES ($1, 1)
+		ON CONFLICT (user_id) DO UPDATE SET last_seq = user_event_seqs.last_seq + 1
+		RETURNING last_seq
+	`
+	insert := `
+		INSERT INTO user_events (user_id, seq, type, payload, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	now := time.Now()
+	seqs = make(map[string]int64, len(ids))
+	for _, id := range ids {
+		var seq int64
+		if err = tx.QueryRowContext(ctx, nextSeq, id).Scan(&seq); err != nil {
+			return nil, err
+		}
+		if _, err = tx.ExecContext(ctx, insert, id, seq, eventType, []byte(payload), now); err != nil {
+			return nil, err
+		}
+		seqs[id] = seq
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return seqs, nil
+}
+
+func (s *SQLStore) LastSeq(ctx context.Context, userID string) (int64, error) {
+	query := `SELECT last_seq FROM user_event_seqs WHERE user_id = $1`
+
+	var seq int64
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+func (s *SQLStore) ListSince(ctx context.Context, userID string, since int64, limit int) ([]*Event, error) {
+	query := `
+		SELECT user_id, seq, type, payload, created_at
+		FROM user_events
+		WHERE user_id = $1 AND seq > $2
+		ORDER BY seq
+		LIMIT $3
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var events []*Event
+	for rows.Next() {
+		var (
+			e       Event
+			payload []byte
+		)
+		if err := rows.Scan(&e.UserID, &e.Seq, &e.Type, &payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Payload = payload
+		events = append(events, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (s *SQLStore) DeleteBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM user_events
+		WHERE (user_id, seq) IN (
+			SELECT user_id, seq FROM user_events WHERE created_at < $1 LIMIT $2
+		)
+	`
+
+	result, err := s.db.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,164 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAppend(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	payload := json.RawMessage(`{"message_id":"message-1"}`)
+
+	// Users are numbered in sorted order and duplicates are dropped.
+	mock.ExpectBegin()
+	for _, u := range []struct {
+		id  string
+		seq int64
+	}{{"user-1", 7}, {"user-2", 1}} {
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO user_event_seqs (user_id, last_seq) VALUES ($1, 1) ON CONFLICT (user_id) DO UPDATE SET last_seq = user_event_seqs.last_seq + 1 RETURNING last_seq`)).
+			WithArgs(u.id).
+			WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(u.seq))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_events (user_id, seq, type, payload, created_at)`)).
+			WithArgs(u.id, u.seq, "message_delivered", []byte(payload), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	seqs, err := store.Append(ctx, []string{"user-2", "user-1", "user-2"}, "message_delivered", payload)
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if len(seqs) != 2 || seqs["user-1"] != 7 || seqs["user-2"] != 1 {
+		t.Errorf("unexpected sequence numbers: %v", seqs)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLastSeq(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	query := regexp.QuoteMeta(`SELECT last_seq FROM user_event_seqs WHERE user_id = $1`)
+	mock.ExpectQuery(query).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(42))
+	mock.ExpectQuery(query).
+		WithArgs("user-2").
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}))
+
+	seq, err := store.LastSeq(ctx, "user-1")
+	if err != nil || seq != 42 {
+		t.Errorf("expected 42, got %d (err %v)", seq, err)
+	}
+
+	// A user without events starts at zero.
+	seq, err = store.LastSeq(ctx, "user-2")
+	if err != nil || seq != 0 {
+		t.Errorf("expected 0, got %d (err %v)", seq, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListSince(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM user_events WHERE user_id = $1 AND seq > $2 ORDER BY seq LIMIT $3`)).
+		WithArgs("user-1", int64(5), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "seq", "type", "payload", "created_at"}).
+			AddRow("user-1", 6, "message_delivered", []byte(`{"message_id":"message-1"}`), fixedTime).
+			AddRow("user-1", 7, "receipt_updated", []byte(`{"status":"read"}`), fixedTime))
+
+	events, err := store.ListSince(ctx, "user-1", 5, 100)
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if len(events) != 2 || events[0].Seq != 6 || events[1].Seq != 7 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if string(events[0].Payload) != `{"message_id":"message-1"}` {
+		t.Errorf("unexpected payload: %s", events[0].Payload)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteBefore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	before := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_events WHERE (user_id, seq) IN ( SELECT user_id, seq FROM user_events WHERE created_at < $1 LIMIT $2 )`)).
+		WithArgs(before, 100).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := store.DeleteBefore(ctx, before, 100)
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 rows purged, got %d", n)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,94 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Message represents a chat message posted to a conversation.
+type Message struct {
+	ID             string    `json:"id"`
+	ConversationID string    `json:"conversation_id"`
+	SenderID       string    `json:"sender_id"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	// ClientID is the optional sender-generated ID used to de-duplicate
+	// retried sends. It is unique per sender.
+	ClientID string `json:"client_id,omitempty"`
+
+	// EditedAt is when the content was last changed, or nil if it never
+	// was.
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+
+	// DeletedAt is set once the message has been deleted for everyone. The
+	// row stays as a tombstone with empty Content.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+}
+
+// Revision is a superseded version of a message's content.
+type Revision struct {
+	MessageID string `json:"message_id"`
+	Content   string `json:"content"`
+	// ReplacedAt is when this content was replaced by an edit.
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+var (
+	ErrMessageNotFound   = errors.New("message not found")
+	ErrDuplicateClientID = errors.New("client_id already used by this sender")
+)
+
+// ListOptions controls cursor-based pagination over a conversation's
+// messages. At most one of Before and After may be set; when neither is set
+// the most recent messages are returned.
+type ListOptions struct {
+	// Before restricts results to messages older than this message ID.
+	Before string
+	// After restricts results to messages newer than this message ID.
+	After string
+	// Limit is the maximum number of messages to return.
+	Limit int
+	// ViewerID, if set, excludes messages this user deleted for
+	// themselves.
+	ViewerID string
+}
+
+// Store defines message persistence operations.
+type Store interface {
+	// Create inserts a new message. The ID and CreatedAt fields are
+	// populated from the database. It returns ErrDuplicateClientID if the
+	// sender already has a message with the same ClientID.
+	Create(ctx context.Context, msg *Message) error
+
+	// GetByID retrieves a message by its unique ID.
+	GetByID(ctx context.Context, id string) (*Message, error)
+
+	// GetByClientID retrieves the message senderID sent with clientID.
+	GetByClientID(ctx context.Context, senderID, clientID string) (*Message, error)
+
+	// Edit replaces a message's content, keeping the previous content as a
+	// revision, and returns the updated message. Deleted messages cannot be
+	// edited and return ErrMessageNotFound.
+	Edit(ctx context.Context, id, content string, editedAt time.Time) (*Message, error)
+
+	// Delete turns a message into a tombstone for everyone, erasing its
+	// content, its revisions and the copies held in stored user events, and
+	// returns the tombstone. It returns
+	// ErrMessageNotFound if the message does not exist or was already
+	// deleted.
+	Delete(ctx context.Context, id, deletedBy string, deletedAt time.Time) (*Message, error)
+
+	// Hide deletes a message for userID only. Hiding a message twice is
+	// not an error.
+	Hide(ctx context.Context, messageID, userID string, hiddenAt time.Time) error
+
+	// ListRevisions returns a message's superseded versions, oldest first.
+	ListRevisions(ctx context.Context, messageID string) ([]*Revision, error)
+
+	// ListByConversation returns a page of a conversation's messages in
+	// chronological order.
+	ListByConversation(ctx context.Context, conversationID string, opts ListOptions) ([]*Message, error)
+}
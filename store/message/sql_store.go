@@ -0,0 +1,305 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQLStore implements Store using a database/sql connection.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a new SQLStore.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// messageColumns is the column list scanned by scanMessage.
+const messageColumns = `id, conversation_id, sender_id, content, created_at, client_id, edited_at, deleted_at, deleted_by`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMessage(row scanner) (*Message, error) {
+	var (
+		msg       Message
+		clientID  sql.NullString
+		editedAt  sql.NullTime
+		deletedAt sql.NullTime
+		deletedBy sql.NullString
+	)
+	if err := row.Scan(
+		&msg.ID,
+		&msg.ConversationID,
+		&msg.SenderID,
+		&msg.Content,
+		&msg.CreatedAt,
+		&clientID,
+		&editedAt,
+		&deletedAt,
+		&deletedBy,
+	); err != nil {
+		return nil, err
+	}
+	msg.ClientID = clientID.String
+	if editedAt.Valid {
+		msg.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		msg.DeletedAt = &deletedAt.Time
+		msg.DeletedBy = deletedBy.String
+	}
+
+	return &msg, nil
+}
+
+func (s *SQLStore) Create(ctx context.Context, msg *Message) error {
+	// An empty client_id is stored as NULL, which the unique index ignores.
+	query := `
+		INSERT INTO messages (conversation_id, sender_id, content, client_id)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (sender_id, client_id) WHERE client_id IS NOT NULL DO NOTHING
+		RETURNING id, created_at
+	`
+
+	err := s.db.QueryRowContext(ctx, query,
+		msg.ConversationID,
+		msg.SenderID,
+		msg.Content,
+		msg.ClientID,
+	).Scan(&msg.ID, &msg.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrDuplicateClientID
+	}
+
+	return err
+}
+
+func (s *SQLStore) GetByID(ctx context.Context, id string) (*Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE id = $1`
+
+	msg, err := scanMessage(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (s *SQLStore) GetByClientID(ctx context.Context, senderID, clientID string) (*Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE sender_id = $1 AND client_id = $2`
+
+	msg, err := scanMessage(s.db.QueryRowContext(ctx, query, senderID, clientID))
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (s *SQLStore) Edit(ctx context.Context, id, content string, editedAt time.Time) (msg *Message, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Lock the row so that concurrent edits each record the content they
+	// actually replaced.
+	var previous string
+	err = tx.QueryRowContext(ctx, `SELECT content FROM messages WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&previous)
+	if err == sql.ErrNoRows {
+		err = ErrMessageNotFound
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	revisionInsert := `
+		INSERT INTO message_revisions (message_id, content, replaced_at)
+		VALUES ($1, $2, $3)
+	`
+	if _, err = tx.ExecContext(ctx, revisionInsert, id, previous, editedAt); err != nil {
+		return nil, err
+	}
+
+	update := `
+		UPDATE messages SET content = $2, edited_at = $3
+		WHERE id = $1
+		RETURNING ` + messageColumns
+
+	msg, err = scanMessage(tx.QueryRowContext(ctx, update, id, content, editedAt))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id, deletedBy string, deletedAt time.Time) (msg *Message, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	update := `
+		UPDATE messages SET content = '', deleted_at = $2, deleted_by = $3
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING ` + messageColumns
+
+	msg, err = scanMessage(tx.QueryRowContext(ctx, update, id, deletedAt, deletedBy))
+	if err == sql.ErrNoRows {
+		err = ErrMessageNotFound
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Earlier versions and the copies kept in members' event streams for
+	// reconnect replay would otherwise still reveal the content.
+	if _, err = tx.ExecContext(ctx, `DELETE FROM message_revisions WHERE message_id = $1`, id); err != nil {
+		return nil, err
+	}
+
+	redact := `
+		UPDATE user_events SET payload = jsonb_set(payload, '{content}', '""')
+		WHERE payload->>'message_id' = $1 AND payload ? 'content'
+	`
+	if _, err = tx.ExecContext(ctx, redact, id); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (s *SQLStore) Hide(ctx context.Context, messageID, userID string, hiddenAt time.Time) error {
+	query := `
+		INSERT INTO hidden_messages (message_id, user_id, hidden_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, user_id) DO NOTHING
+	`
+
+	_, err := s.db.ExecContext(ctx, query, messageID, userID, hiddenAt)
+	return err
+}
+
+func (s *SQLStore) ListRevisions(ctx context.Context, messageID string) ([]*Revision, error) {
+	query := `
+		SELECT message_id, content, replaced_at
+		FROM message_revisions
+		WHERE message_id = $1
+		ORDER BY replaced_at, id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	revisions := []*Revision{}
+	for rows.Next() {
+		var r Revision
+		if err := rows.Scan(&r.MessageID, &r.Content, &r.ReplacedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (s *SQLStore) ListByConversation(ctx context.Context, conversationID string, opts ListOptions) ([]*Message, error) {
+	var (
+		cursor string
+		order  = "DESC"
+		args   = []interface{}{conversationID}
+	)
+
+	switch {
+	case opts.After != "":
+		cursor = `AND (created_at, id) > (SELECT created_at, id FROM messages WHERE id = $2 AND conversation_id = $1)`
+		order = "ASC"
+		args = append(args, opts.After)
+	case opts.Before != "":
+		cursor = `AND (created_at, id) < (SELECT created_at, id FROM messages WHERE id = $2 AND conversation_id = $1)`
+		args = append(args, opts.Before)
+	}
+
+	var hidden string
+	if opts.ViewerID != "" {
+		args = append(args, opts.ViewerID)
+		hidden = fmt.Sprintf(`AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = messages.id AND h.user_id = $%d)`, len(args))
+	}
+
+	args = append(args, opts.Limit)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM messages
+		WHERE conversation_id = $1 %s %s
+		ORDER BY created_at %s, id %s
+		LIMIT $%d
+	`, messageColumns, cursor, hidden, order, order, len(args))
+
+	// Newest-first queries are reversed before returning so callers always
+	// receive chronological order.
+	reverse := order == "DESC"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	msgs := make([]*Message, 0, opts.Limit)
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if reverse {
+		for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+			msgs[i], msgs[j] = msgs[j], msgs[i]
+		}
+	}
+
+	return msgs, nil
+}
@@ -0,0 +1,447 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	msg := &Message{
+		ConversationID: "convo-1",
+		SenderID:       "user-123",
+		Content:        "Hello world",
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO messages (conversation_id, sender_id, content, client_id) VALUES ($1, $2, $3, NULLIF($4, ''))`)).
+		WithArgs(msg.ConversationID, msg.SenderID, msg.Content, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("message-1", fixedTime))
+
+	err = store.Create(ctx, msg)
+	if err != nil {
+		t.Errorf("error was not expected while creating message: %s", err)
+	}
+	if msg.ID != "message-1" {
+		t.Errorf("expected id message-1, got %s", msg.ID)
+	}
+	if !msg.CreatedAt.Equal(fixedTime) {
+		t.Errorf("expected created_at %v, got %v", fixedTime, msg.CreatedAt)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateDuplicateClientID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	msg := &Message{
+		ConversationID: "convo-1",
+		SenderID:       "user-123",
+		Content:        "Hello again",
+		ClientID:       "client-1",
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`ON CONFLICT (sender_id, client_id) WHERE client_id IS NOT NULL DO NOTHING`)).
+		WithArgs(msg.ConversationID, msg.SenderID, msg.Content, msg.ClientID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}))
+
+	if err := store.Create(ctx, msg); err != ErrDuplicateClientID {
+		t.Errorf("expected ErrDuplicateClientID, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetByClientID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM messages WHERE sender_id = $1 AND client_id = $2`)).
+		WithArgs("user-123", "client-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "conversation_id", "sender_id", "content", "created_at", "client_id", "edited_at", "deleted_at", "deleted_by"}).
+			AddRow("message-1", "convo-1", "user-123", "Hello world", fixedTime, "client-1", nil, nil, nil))
+
+	msg, err := store.GetByClientID(ctx, "user-123", "client-1")
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if msg.ID != "message-1" || msg.ClientID != "client-1" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Success Case
+	rows := sqlmock.NewRows([]string{"id", "conversation_id", "sender_id", "content", "created_at", "client_id", "edited_at", "deleted_at", "deleted_by"}).
+		AddRow("message-1", "convo-1", "user-123", "Hello world", fixedTime, nil, nil, nil, nil)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, conversation_id, sender_id, content, created_at, client_id, edited_at, deleted_at, deleted_by FROM messages WHERE id = $1`)).
+		WithArgs("message-1").
+		WillReturnRows(rows)
+
+	msg, err := store.GetByID(ctx, "message-1")
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if msg == nil {
+		t.Errorf("expected message, got nil")
+	} else if msg.Content != "Hello world" {
+		t.Errorf("expected content %q, got %q", "Hello world", msg.Content)
+	}
+
+	// Not Found Case
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, conversation_id, sender_id, content, created_at, client_id, edited_at, deleted_at, deleted_by FROM messages WHERE id = $1`)).
+		WithArgs("unknown").
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = store.GetByID(ctx, "unknown")
+	if err != ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListByConversation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	columns := []string{"id", "conversation_id", "sender_id", "content", "created_at", "client_id", "edited_at", "deleted_at", "deleted_by"}
+
+	// Latest page is fetched newest-first and returned oldest-first.
+	mock.ExpectQuery(`ORDER BY created_at DESC, id DESC\s+LIMIT \$2`).
+		WithArgs("convo-1", 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("message-3", "convo-1", "user-1", "third", fixedTime.Add(2*time.Minute), nil, nil, nil, nil).
+			AddRow("message-2", "convo-1", "user-2", "second", fixedTime.Add(time.Minute), nil, nil, nil, nil))
+
+	msgs, err := store.ListByConversation(ctx, "convo-1", ListOptions{Limit: 2})
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if len(msgs) != 2 || msgs[0].ID != "message-2" || msgs[1].ID != "message-3" {
+		t.Errorf("expected [message-2 message-3], got %v", messageIDs(msgs))
+	}
+
+	// Before cursor.
+	mock.ExpectQuery(regexp.QuoteMeta(`(created_at, id) < (SELECT created_at, id FROM messages WHERE id = $2 AND conversation_id = $1)`)).
+		WithArgs("convo-1", "message-2", 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("message-1", "convo-1", "user-1", "first", fixedTime, nil, nil, nil, nil))
+
+	msgs, err = store.ListByConversation(ctx, "convo-1", ListOptions{Before: "message-2", Limit: 2})
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if len(msgs) != 1 || msgs[0].ID != "message-1" {
+		t.Errorf("expected [message-1], got %v", messageIDs(msgs))
+	}
+
+	// After cursor is already in chronological order.
+	mock.ExpectQuery(regexp.QuoteMeta(`(created_at, id) > (SELECT created_at, id FROM messages WHERE id = $2 AND conversation_id = $1)`)).
+		WithArgs("convo-1", "message-1", 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("message-2", "convo-1", "user-2", "second", fixedTime.Add(time.Minute), nil, nil, nil, nil).
+			AddRow("message-3", "convo-1", "user-1", "third", fixedTime.Add(2*time.Minute), nil, nil, nil, nil))
+
+	msgs, err = store.ListByConversation(ctx, "convo-1", ListOptions{After: "message-1", Limit: 2})
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if len(msgs) != 2 || msgs[0].ID != "message-2" || msgs[1].ID != "message-3" {
+		t.Errorf("expected [message-2 message-3], got %v", messageIDs(msgs))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	editedAt := fixedTime.Add(time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT content FROM messages WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`)).
+		WithArgs("message-1").
+		WillReturnRows(sqlmock.NewRows([]string{"content"}).AddRow("Helo world"))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO message_revisions (message_id, content, replaced_at) VALUES ($1, $2, $3)`)).
+		WithArgs("message-1", "Helo world", editedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE messages SET content = $2, edited_at = $3 WHERE id = $1`)).
+		WithArgs("message-1", "Hello world", editedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "conversation_id", "sender_id", "content", "created_at", "client_id", "edited_at", "deleted_at", "deleted_by"}).
+			AddRow("message-1", "convo-1", "user-123", "Hello world", fixedTime, nil, editedAt, nil, nil))
+	mock.ExpectCommit()
+
+	msg, err := store.Edit(ctx, "message-1", "Hello world", editedAt)
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if msg.Content != "Hello world" || msg.EditedAt == nil || !msg.EditedAt.Equal(editedAt) {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+
+	// Unknown message.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT content FROM messages WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`)).
+		WithArgs("unknown").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	if _, err := store.Edit(ctx, "unknown", "Hello world", editedAt); err != ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListRevisions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT message_id, content, replaced_at FROM message_revisions WHERE message_id = $1 ORDER BY replaced_at, id`)).
+		WithArgs("message-1").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "content", "replaced_at"}).
+			AddRow("message-1", "first draft", fixedTime).
+			AddRow("message-1", "second draft", fixedTime.Add(time.Minute)))
+
+	revisions, err := store.ListRevisions(ctx, "message-1")
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if len(revisions) != 2 || revisions[0].Content != "first draft" || revisions[1].Content != "second draft" {
+		t.Errorf("unexpected revisions: %+v", revisions)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListByConversationHidesForViewer(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = messages.id AND h.user_id = $3) ORDER BY created_at DESC, id DESC LIMIT $4`)).
+		WithArgs("convo-1", "message-2", "user-1", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "conversation_id", "sender_id", "content", "created_at", "client_id", "edited_at", "deleted_at", "deleted_by"}))
+
+	msgs, err := store.ListByConversation(ctx, "convo-1", ListOptions{Before: "message-2", Limit: 2, ViewerID: "user-1"})
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if len(msgs) != 0 {
+		t.Errorf("expected no messages, got %v", messageIDs(msgs))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	deletedAt := fixedTime.Add(time.Minute)
+	update := regexp.QuoteMeta(`UPDATE messages SET content = '', deleted_at = $2, deleted_by = $3 WHERE id = $1 AND deleted_at IS NULL`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(update).
+		WithArgs("message-1", deletedAt, "user-123").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "conversation_id", "sender_id", "content", "created_at", "client_id", "edited_at", "deleted_at", "deleted_by"}).
+			AddRow("message-1", "convo-1", "user-123", "", fixedTime, nil, nil, deletedAt, "user-123"))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM message_revisions WHERE message_id = $1`)).
+		WithArgs("message-1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE user_events SET payload = jsonb_set(payload, '{content}', '""') WHERE payload->>'message_id' = $1 AND payload ? 'content'`)).
+		WithArgs("message-1").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	msg, err := store.Delete(ctx, "message-1", "user-123", deletedAt)
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if msg.Content != "" || msg.DeletedAt == nil || msg.DeletedBy != "user-123" {
+		t.Errorf("expected a tombstone, got %+v", msg)
+	}
+
+	// Already deleted.
+	mock.ExpectBegin()
+	mock.ExpectQuery(update).
+		WithArgs("message-1", deletedAt, "user-123").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	if _, err := store.Delete(ctx, "message-1", "user-123", deletedAt); err != ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestHide(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	hiddenAt := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO hidden_messages (message_id, user_id, hidden_at) VALUES ($1, $2, $3) ON CONFLICT (message_id, user_id) DO NOTHING`)).
+		WithArgs("message-1", "user-123", hiddenAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.Hide(ctx, "message-1", "user-123", hiddenAt); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func messageIDs(msgs []*Message) []string {
+	ids := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
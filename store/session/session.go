@@ -2,26 +2,88 @@ package session
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"time"
 )
 
 // Session represents a user authentication session.
 type Session struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Token     string    `json:"token"`
-	CreatedAt time.Time `json:"created_at"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Token      string    `json:"-"` // Never expose tokens when listing sessions
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	LastUsedAt time.Time `json:"last_used_at"`
+
+	// RefreshToken is the plaintext refresh token. It is only populated
+	// when a token is issued; the store keeps a hash.
+	RefreshToken string `json:"-"`
+	// RefreshExpiresAt caps how long the session can be kept alive through
+	// refreshes and sliding expiry. Zero for sessions without refresh.
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
 }
 
 var (
-	ErrSessionNotFound = errors.New("session not found")
-	ErrSessionExpired  = errors.New("session expired")
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrSessionExpired       = errors.New("session expired")
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
 )
 
+// HashToken returns the form in which refresh tokens are persisted.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // Store defines the interface for session persistence.
 type Store interface {
+	// Create inserts a session, along with its refresh token if
+	// RefreshToken is set.
 	Create(ctx context.Context, session *Session) error
 	GetByToken(ctx context.Context, token string) (*Session, error)
+
+	// GetByID retrieves an unexpired session by its ID.
+	GetByID(ctx context.Context, id string) (*Session, error)
+
+	// Rotate exchanges a refresh token for a new access token and refresh
+	// token on the same session. The access token expires at expiresAt, or
+	// at the session's RefreshExpiresAt if that is earlier.
+	//
+	// Presenting a refresh token that was already rotated is treated as
+	// theft: the whole session is deleted and ErrRefreshTokenReused is
+	// returned together with the revoked session (ID and UserID only).
+	Rotate(ctx context.Context, refreshToken, newToken, newRefreshToken string, expiresAt time.Time) (*Session, error)
+
+	// Extend slides an unexpired session's expiry forward to expiresAt,
+	// capped at its RefreshExpiresAt. Sessions that predate refresh tokens
+	// have none and are capped at maxLifetime after their creation instead.
+	Extend(ctx context.Context, id string, expiresAt time.Time, maxLifetime time.Duration) error
+
+	// ListByUser returns the unexpired sessions owned by userID, most
+	// recently used first.
+	ListByUser(ctx context.Context, userID string) ([]*Session, error)
+
+	// Touch records that a session was used from the given client.
+	Touch(ctx context.Context, id string, lastUsedAt time.Time, userAgent, ipAddress string) error
+
+	// Delete revokes a single session owned by userID. It returns
+	// ErrSessionNotFound if no such session exists.
+	Delete(ctx context.Context, userID, id string) error
+
+	// DeleteByUser revokes every session owned by userID and returns the
+	// IDs of the revoked sessions.
+	DeleteByUser(ctx context.Context, userID string) ([]string, error)
+
+	// DeleteOthers revokes every session owned by userID except keepID and
+	// returns the IDs of the revoked sessions.
+	DeleteOthers(ctx context.Context, userID, keepID string) ([]string, error)
+
+	// DeleteExpired purges up to limit sessions that can no longer be used
+	// or refreshed as of before, and returns how many rows were removed.
+	DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error)
 }
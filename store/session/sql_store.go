@@ -16,38 +16,94 @@ func NewSQLStore(db *sql.DB) *SQLStore {
 	return &SQLStore{db: db}
 }
 
-func (s *SQLStore) Create(ctx context.Context, sess *Session) error {
+func (s *SQLStore) Create(ctx context.Context, sess *Session) (err error) {
 	query := `
-		INSERT INTO sessions (user_id, token, created_at, expires_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO sessions (user_id, token, created_at, expires_at, user_agent, ip_address, last_used_at, refresh_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
 	`
 
 	if sess.CreatedAt.IsZero() {
 		sess.CreatedAt = time.Now()
 	}
+	if sess.LastUsedAt.IsZero() {
+		sess.LastUsedAt = sess.CreatedAt
+	}
+
+	var refreshExpiresAt sql.NullTime
+	if !sess.RefreshExpiresAt.IsZero() {
+		refreshExpiresAt = sql.NullTime{Time: sess.RefreshExpiresAt, Valid: true}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
 
-	_, err := s.db.ExecContext(ctx, query,
+	if err = tx.QueryRowContext(ctx, query,
 		sess.UserID,
 		sess.Token,
 		sess.CreatedAt,
 		sess.ExpiresAt,
-	)
+		sess.UserAgent,
+		sess.IPAddress,
+		sess.LastUsedAt,
+		refreshExpiresAt,
+	).Scan(&sess.ID); err != nil {
+		return err
+	}
+
+	if sess.RefreshToken != "" {
+		refreshInsert := `INSERT INTO refresh_tokens (token_hash, session_id, created_at) VALUES ($1, $2, $3)`
+		if _, err = tx.ExecContext(ctx, refreshInsert, HashToken(sess.RefreshToken), sess.ID, sess.CreatedAt); err != nil {
+			return err
+		}
+	}
 
-	return err
+	return tx.Commit()
 }
 
 func (s *SQLStore) GetByToken(ctx context.Context, token string) (*Session, error) {
-	query := `SELECT id, user_id, token, created_at, expires_at FROM sessions WHERE token = $1`
+	query := `
+		SELECT id, user_id, token, created_at, expires_at, user_agent, ip_address, last_used_at, refresh_expires_at
+		FROM sessions
+		WHERE token = $1
+	`
+
+	return s.getOne(ctx, query, token)
+}
 
-	row := s.db.QueryRowContext(ctx, query, token)
+func (s *SQLStore) GetByID(ctx context.Context, id string) (*Session, error) {
+	query := `
+		SELECT id, user_id, token, created_at, expires_at, user_agent, ip_address, last_used_at, refresh_expires_at
+		FROM sessions
+		WHERE id = $1
+	`
+
+	return s.getOne(ctx, query, id)
+}
+
+// getOne scans a single session row and rejects expired sessions.
+func (s *SQLStore) getOne(ctx context.Context, query string, arg interface{}) (*Session, error) {
+	row := s.db.QueryRowContext(ctx, query, arg)
 
 	var sess Session
+	var lastUsed, refreshExpiresAt sql.NullTime
 	err := row.Scan(
 		&sess.ID,
 		&sess.UserID,
 		&sess.Token,
 		&sess.CreatedAt,
 		&sess.ExpiresAt,
+		&sess.UserAgent,
+		&sess.IPAddress,
+		&lastUsed,
+		&refreshExpiresAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -60,5 +116,276 @@ func (s *SQLStore) GetByToken(ctx context.Context, token string) (*Session, erro
 		return nil, ErrSessionExpired
 	}
 
+	if lastUsed.Valid {
+		sess.LastUsedAt = lastUsed.Time
+	}
+	if refreshExpiresAt.Valid {
+		sess.RefreshExpiresAt = refreshExpiresAt.Time
+	}
+
+	return &sess, nil
+}
+
+func (s *SQLStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	query := `
+		SELECT id, user_id, created_at, expires_at, user_agent, ip_address, last_used_at, refresh_expires_at
+		FROM sessions
+		WHERE user_id = $1 AND expires_at > $2
+		ORDER BY last_used_at DESC NULLS LAST, created_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var sess Session
+		var lastUsed, refreshExpiresAt sql.NullTime
+		if err := rows.Scan(
+			&sess.ID,
+			&sess.UserID,
+			&sess.CreatedAt,
+			&sess.ExpiresAt,
+			&sess.UserAgent,
+			&sess.IPAddress,
+			&lastUsed,
+			&refreshExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			sess.LastUsedAt = lastUsed.Time
+		}
+		if refreshExpiresAt.Valid {
+			sess.RefreshExpiresAt = refreshExpiresAt.Time
+		}
+		sessions = append(sessions, &sess)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (s *SQLStore) Touch(ctx context.Context, id string, lastUsedAt time.Time, userAgent, ipAddress string) error {
+	query := `UPDATE sessions SET last_used_at = $1, user_agent = $2, ip_address = $3 WHERE id = $4`
+
+	result, err := s.db.ExecContext(ctx, query, lastUsedAt, userAgent, ipAddress, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, userID, id string) error {
+	query := `DELETE FROM sessions WHERE id = $1 AND user_id = $2`
+
+	result, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLStore) DeleteByUser(ctx context.Context, userID string) ([]string, error) {
+	query := `DELETE FROM sessions WHERE user_id = $1 RETURNING id`
+
+	return s.deleteIDs(ctx, query, userID)
+}
+
+func (s *SQLStore) DeleteOthers(ctx context.Context, userID, keepID string) ([]string, error) {
+	query := `DELETE FROM sessions WHERE user_id = $1 AND id <> $2 RETURNING id`
+
+	return s.deleteIDs(ctx, query, userID, keepID)
+}
+
+// deleteIDs runs a DELETE ... RETURNING id statement and collects the IDs.
+func (s *SQLStore) deleteIDs(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (s *SQLStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	// A session whose access token has lapsed can still be revived through
+	// its refresh token, so it is only garbage once both have expired.
+	query := `
+		DELETE FROM sessions
+		WHERE id IN (
+			SELECT id FROM sessions
+			WHERE expires_at < $1 AND (refresh_expires_at IS NULL OR refresh_expires_at < $1)
+			LIMIT $2
+		)
+	`
+
+	result, err := s.db.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *SQLStore) Rotate(ctx context.Context, refreshToken, newToken, newRefreshToken string, expiresAt time.Time) (_ *Session, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil && err != ErrRefreshTokenReused {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := time.Now()
+
+	lookup := `
+		SELECT rt.session_id, rt.used_at, s.refresh_expires_at
+		FROM refresh_tokens rt
+		JOIN sessions s ON s.id = rt.session_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt
+	`
+
+	var (
+		sessionID        string
+		usedAt           sql.NullTime
+		refreshExpiresAt sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx, lookup, HashToken(refreshToken)).Scan(&sessionID, &usedAt, &refreshExpiresAt)
+	if err == sql.ErrNoRows {
+		err = ErrRefreshTokenNotFound
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		revoked := &Session{ID: sessionID}
+		if err = tx.QueryRowContext(ctx, `DELETE FROM sessions WHERE id = $1 RETURNING user_id`, sessionID).Scan(&revoked.UserID); err != nil {
+			return nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+		return revoked, ErrRefreshTokenReused
+	}
+
+	if !refreshExpiresAt.Valid || now.After(refreshExpiresAt.Time) {
+		err = ErrSessionExpired
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = $1 WHERE token_hash = $2`, now, HashToken(refreshToken)); err != nil {
+		return nil, err
+	}
+
+	refreshInsert := `INSERT INTO refresh_tokens (token_hash, session_id, created_at) VALUES ($1, $2, $3)`
+	if _, err = tx.ExecContext(ctx, refreshInsert, HashToken(newRefreshToken), sessionID, now); err != nil {
+		return nil, err
+	}
+
+	update := `
+		UPDATE sessions
+		SET token = $1, expires_at = LEAST($2, refresh_expires_at), last_used_at = $3
+		WHERE id = $4
+		RETURNING id, user_id, created_at, expires_at, user_agent, ip_address, last_used_at, refresh_expires_at
+	`
+
+	var sess Session
+	var lastUsed, refreshExpiry sql.NullTime
+	if err = tx.QueryRowContext(ctx, update, newToken, expiresAt, now, sessionID).Scan(
+		&sess.ID,
+		&sess.UserID,
+		&sess.CreatedAt,
+		&sess.ExpiresAt,
+		&sess.UserAgent,
+		&sess.IPAddress,
+		&lastUsed,
+		&refreshExpiry,
+	); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	sess.Token = newToken
+	sess.RefreshToken = newRefreshToken
+	if lastUsed.Valid {
+		sess.LastUsedAt = lastUsed.Time
+	}
+	if refreshExpiry.Valid {
+		sess.RefreshExpiresAt = refreshExpiry.Time
+	}
+
 	return &sess, nil
 }
+
+func (s *SQLStore) Extend(ctx context.Context, id string, expiresAt time.Time, maxLifetime time.Duration) error {
+	// LEAST ignores NULL, so a missing refresh cap must be filled in, or
+	// legacy sessions would slide forever.
+	query := `
+		UPDATE sessions
+		SET expires_at = LEAST($1, COALESCE(refresh_expires_at, created_at + $4 * INTERVAL '1 second'))
+		WHERE id = $2 AND expires_at > $3
+	`
+
+	result, err := s.db.ExecContext(ctx, query, expiresAt, id, time.Now(), int64(maxLifetime/time.Second))
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
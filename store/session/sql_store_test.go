@@ -2,6 +2,7 @@ package session
 
 import (
 	"context"
+	"database/sql"
 	"regexp"
 	"testing"
 	"time"
@@ -29,16 +30,23 @@ func TestCreate(t *testing.T) {
 		Token:     "token-abc",
 		CreatedAt: fixedTime,
 		ExpiresAt: fixedTime.Add(time.Hour),
+		UserAgent: "test-agent",
+		IPAddress: "192.0.2.1",
 	}
 
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO sessions (user_id, token, created_at, expires_at) VALUES ($1, $2, $3, $4)`)).
-		WithArgs(sess.UserID, sess.Token, sess.CreatedAt, sess.ExpiresAt).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO sessions (user_id, token, created_at, expires_at, user_agent, ip_address, last_used_at, refresh_expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`)).
+		WithArgs(sess.UserID, sess.Token, sess.CreatedAt, sess.ExpiresAt, sess.UserAgent, sess.IPAddress, sess.CreatedAt, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("session-1"))
+	mock.ExpectCommit()
 
 	err = store.Create(ctx, sess)
 	if err != nil {
 		t.Errorf("error was not expected while creating session: %s", err)
 	}
+	if sess.ID != "session-1" {
+		t.Errorf("expected id session-1, got %s", sess.ID)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -62,10 +70,10 @@ func TestGetByToken(t *testing.T) {
 	token := "token-abc"
 	now := time.Now()
 
-	rows := sqlmock.NewRows([]string{"id", "user_id", "token", "created_at", "expires_at"}).
-		AddRow("session-1", "user-123", token, now, now.Add(time.Hour))
+	rows := sqlmock.NewRows([]string{"id", "user_id", "token", "created_at", "expires_at", "user_agent", "ip_address", "last_used_at", "refresh_expires_at"}).
+		AddRow("session-1", "user-123", token, now, now.Add(time.Hour), "test-agent", "192.0.2.1", now, nil)
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, token, created_at, expires_at FROM sessions WHERE token = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, token, created_at, expires_at, user_agent, ip_address, last_used_at, refresh_expires_at FROM sessions WHERE token = $1`)).
 		WithArgs(token).
 		WillReturnRows(rows)
 
@@ -101,10 +109,10 @@ func TestGetByTokenExpired(t *testing.T) {
 	token := "token-expired"
 	now := time.Now()
 
-	rows := sqlmock.NewRows([]string{"id", "user_id", "token", "created_at", "expires_at"}).
-		AddRow("session-2", "user-123", token, now, now.Add(-time.Hour))
+	rows := sqlmock.NewRows([]string{"id", "user_id", "token", "created_at", "expires_at", "user_agent", "ip_address", "last_used_at", "refresh_expires_at"}).
+		AddRow("session-2", "user-123", token, now, now.Add(-time.Hour), "", "", nil, nil)
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, token, created_at, expires_at FROM sessions WHERE token = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, token, created_at, expires_at, user_agent, ip_address, last_used_at, refresh_expires_at FROM sessions WHERE token = $1`)).
 		WithArgs(token).
 		WillReturnRows(rows)
 
@@ -117,3 +125,418 @@ func TestGetByTokenExpired(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	query := regexp.QuoteMeta(`DELETE FROM sessions WHERE id = $1 AND user_id = $2`)
+
+	// Success Case
+	mock.ExpectExec(query).
+		WithArgs("session-1", "user-123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.Delete(ctx, "user-123", "session-1"); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	// Another user's session is not found.
+	mock.ExpectExec(query).
+		WithArgs("session-1", "user-456").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.Delete(ctx, "user-456", "session-1"); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteByUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM sessions WHERE user_id = $1 RETURNING id`)).
+		WithArgs("user-123").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("session-1").AddRow("session-2"))
+
+	ids, err := store.DeleteByUser(ctx, "user-123")
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("expected 2 revoked sessions, got %v", ids)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListByUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "user_id", "created_at", "expires_at", "user_agent", "ip_address", "last_used_at", "refresh_expires_at"}).
+		AddRow("session-1", "user-123", now, now.Add(time.Hour), "agent-a", "192.0.2.1", now, now.Add(24*time.Hour)).
+		AddRow("session-2", "user-123", now, now.Add(time.Hour), "agent-b", "192.0.2.2", nil, nil)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, created_at, expires_at, user_agent, ip_address, last_used_at, refresh_expires_at FROM sessions WHERE user_id = $1 AND expires_at > $2`)).
+		WithArgs("user-123", sqlmock.AnyArg()).
+		WillReturnRows(rows)
+
+	sessions, err := store.ListByUser(ctx, "user-123")
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	if sessions[0].UserAgent != "agent-a" || !sessions[1].LastUsedAt.IsZero() {
+		t.Errorf("unexpected sessions: %+v, %+v", sessions[0], sessions[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE sessions SET last_used_at = $1, user_agent = $2, ip_address = $3 WHERE id = $4`)).
+		WithArgs(now, "agent", "192.0.2.1", "session-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.Touch(ctx, "session-1", now, "agent", "192.0.2.1"); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateWithRefreshToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	sess := &Session{
+		UserID:           "user-123",
+		Token:            "token-abc",
+		CreatedAt:        fixedTime,
+		ExpiresAt:        fixedTime.Add(time.Hour),
+		RefreshToken:     "refresh-abc",
+		RefreshExpiresAt: fixedTime.Add(30 * 24 * time.Hour),
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO sessions`)).
+		WithArgs(sess.UserID, sess.Token, sess.CreatedAt, sess.ExpiresAt, "", "", sess.CreatedAt, sess.RefreshExpiresAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("session-1"))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens (token_hash, session_id, created_at) VALUES ($1, $2, $3)`)).
+		WithArgs(HashToken("refresh-abc"), "session-1", sess.CreatedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := store.Create(ctx, sess); err != nil {
+		t.Errorf("error was not expected while creating session: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT rt.session_id, rt.used_at, s.refresh_expires_at FROM refresh_tokens rt`)).
+		WithArgs(HashToken("refresh-old")).
+		WillReturnRows(sqlmock.NewRows([]string{"session_id", "used_at", "refresh_expires_at"}).
+			AddRow("session-1", nil, now.Add(24*time.Hour)))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET used_at = $1 WHERE token_hash = $2`)).
+		WithArgs(sqlmock.AnyArg(), HashToken("refresh-old")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens (token_hash, session_id, created_at) VALUES ($1, $2, $3)`)).
+		WithArgs(HashToken("refresh-new"), "session-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE sessions SET token = $1, expires_at = LEAST($2, refresh_expires_at), last_used_at = $3 WHERE id = $4`)).
+		WithArgs("token-new", expiresAt, sqlmock.AnyArg(), "session-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "created_at", "expires_at", "user_agent", "ip_address", "last_used_at", "refresh_expires_at"}).
+			AddRow("session-1", "user-123", now, expiresAt, "agent", "192.0.2.1", now, now.Add(24*time.Hour)))
+	mock.ExpectCommit()
+
+	sess, err := store.Rotate(ctx, "refresh-old", "token-new", "refresh-new", expiresAt)
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if sess.Token != "token-new" || sess.RefreshToken != "refresh-new" || sess.UserID != "user-123" {
+		t.Errorf("unexpected session: %+v", sess)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRotateReuseRevokesSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT rt.session_id, rt.used_at, s.refresh_expires_at FROM refresh_tokens rt`)).
+		WithArgs(HashToken("refresh-old")).
+		WillReturnRows(sqlmock.NewRows([]string{"session_id", "used_at", "refresh_expires_at"}).
+			AddRow("session-1", now.Add(-time.Minute), now.Add(24*time.Hour)))
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM sessions WHERE id = $1 RETURNING user_id`)).
+		WithArgs("session-1").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("user-123"))
+	mock.ExpectCommit()
+
+	sess, err := store.Rotate(ctx, "refresh-old", "token-new", "refresh-new", now.Add(time.Hour))
+	if err != ErrRefreshTokenReused {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if sess == nil || sess.ID != "session-1" || sess.UserID != "user-123" {
+		t.Errorf("expected revoked session-1, got %+v", sess)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	query := regexp.QuoteMeta(`SELECT id, user_id, token, created_at, expires_at, user_agent, ip_address, last_used_at, refresh_expires_at FROM sessions WHERE id = $1`)
+
+	// Success Case
+	mock.ExpectQuery(query).
+		WithArgs("session-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "token", "created_at", "expires_at", "user_agent", "ip_address", "last_used_at", "refresh_expires_at"}).
+			AddRow("session-1", "user-123", "token-abc", now, now.Add(time.Hour), "", "", nil, nil))
+
+	sess, err := store.GetByID(ctx, "session-1")
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if sess == nil || sess.UserID != "user-123" {
+		t.Errorf("expected session for user-123, got %+v", sess)
+	}
+
+	// Not Found Case
+	mock.ExpectQuery(query).
+		WithArgs("unknown").
+		WillReturnError(sql.ErrNoRows)
+
+	if _, err := store.GetByID(ctx, "unknown"); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	before := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM sessions WHERE id IN ( SELECT id FROM sessions WHERE expires_at < $1 AND (refresh_expires_at IS NULL OR refresh_expires_at < $1) LIMIT $2 )`)).
+		WithArgs(before, 500).
+		WillReturnResult(sqlmock.NewResult(0, 42))
+
+	n, err := store.DeleteExpired(ctx, before, 500)
+	if err != nil {
+		t.Errorf("error was not expected while deleting expired sessions: %s", err)
+	}
+	if n != 42 {
+		t.Errorf("expected 42 rows purged, got %d", n)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteOthers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM sessions WHERE user_id = $1 AND id <> $2 RETURNING id`)).
+		WithArgs("user-123", "session-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("session-2"))
+
+	ids, err := store.DeleteOthers(ctx, "user-123", "session-1")
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if len(ids) != 1 || ids[0] != "session-2" {
+		t.Errorf("expected only session-2 to be revoked, got %v", ids)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestExtend(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	expiresAt := time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC)
+	query := regexp.QuoteMeta(`UPDATE sessions SET expires_at = LEAST($1, COALESCE(refresh_expires_at, created_at + $4 * INTERVAL '1 second')) WHERE id = $2 AND expires_at > $3`)
+
+	// Success Case: legacy sessions are capped at 30 days after creation.
+	mock.ExpectExec(query).
+		WithArgs(expiresAt, "session-1", sqlmock.AnyArg(), int64(30*24*60*60)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.Extend(ctx, "session-1", expiresAt, 30*24*time.Hour); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	// Expired Case
+	mock.ExpectExec(query).
+		WithArgs(expiresAt, "session-2", sqlmock.AnyArg(), int64(30*24*60*60)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.Extend(ctx, "session-2", expiresAt, 30*24*time.Hour); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,74 @@
+package ticket
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SQLStore implements Store using a database/sql connection.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a new SQLStore.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) Create(ctx context.Context, t *Ticket) error {
+	query := `
+		INSERT INTO ws_tickets (ticket_hash, session_id, user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+
+	_, err := s.db.ExecContext(ctx, query,
+		hashValue(t.Value),
+		t.SessionID,
+		t.UserID,
+		t.CreatedAt,
+		t.ExpiresAt,
+	)
+
+	return err
+}
+
+func (s *SQLStore) Consume(ctx context.Context, value string) (*Ticket, error) {
+	query := `
+		DELETE FROM ws_tickets
+		WHERE ticket_hash = $1 AND expires_at > $2
+		RETURNING session_id, user_id, created_at, expires_at
+	`
+
+	row := s.db.QueryRowContext(ctx, query, hashValue(value), time.Now())
+
+	var t Ticket
+	err := row.Scan(&t.SessionID, &t.UserID, &t.CreatedAt, &t.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrTicketNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (s *SQLStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM ws_tickets
+		WHERE ticket_hash IN (
+			SELECT ticket_hash FROM ws_tickets WHERE expires_at < $1 LIMIT $2
+		)
+	`
+
+	result, err := s.db.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,125 @@
+package ticket
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	tk := &Ticket{
+		Value:     "ticket-abc",
+		SessionID: "session-1",
+		UserID:    "user-123",
+		CreatedAt: fixedTime,
+		ExpiresAt: fixedTime.Add(30 * time.Second),
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ws_tickets (ticket_hash, session_id, user_id, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)`)).
+		WithArgs(hashValue("ticket-abc"), tk.SessionID, tk.UserID, tk.CreatedAt, tk.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.Create(ctx, tk); err != nil {
+		t.Errorf("error was not expected while creating ticket: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestConsume(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	query := regexp.QuoteMeta(`DELETE FROM ws_tickets WHERE ticket_hash = $1 AND expires_at > $2 RETURNING session_id, user_id, created_at, expires_at`)
+
+	// First use succeeds.
+	mock.ExpectQuery(query).
+		WithArgs(hashValue("ticket-abc"), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"session_id", "user_id", "created_at", "expires_at"}).
+			AddRow("session-1", "user-123", now, now.Add(30*time.Second)))
+
+	tk, err := store.Consume(ctx, "ticket-abc")
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if tk == nil || tk.SessionID != "session-1" {
+		t.Errorf("expected ticket for session-1, got %+v", tk)
+	}
+
+	// Replay finds nothing.
+	mock.ExpectQuery(query).
+		WithArgs(hashValue("ticket-abc"), sqlmock.AnyArg()).
+		WillReturnError(sql.ErrNoRows)
+
+	if _, err := store.Consume(ctx, "ticket-abc"); err != ErrTicketNotFound {
+		t.Errorf("expected ErrTicketNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	before := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM ws_tickets WHERE ticket_hash IN ( SELECT ticket_hash FROM ws_tickets WHERE expires_at < $1 LIMIT $2 )`)).
+		WithArgs(before, 100).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := store.DeleteExpired(ctx, before, 100)
+	if err != nil {
+		t.Errorf("error was not expected while deleting expired tickets: %s", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 rows purged, got %d", n)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,44 @@
+package ticket
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// Ticket is a short-lived, single-use credential for opening a WebSocket
+// connection on behalf of a session.
+type Ticket struct {
+	// Value is the plaintext ticket. It is only populated when a ticket is
+	// created; the store keeps a hash.
+	Value     string    `json:"-"`
+	SessionID string    `json:"session_id"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+var (
+	ErrTicketNotFound = errors.New("ticket not found")
+)
+
+// Store defines ticket persistence operations.
+type Store interface {
+	Create(ctx context.Context, ticket *Ticket) error
+
+	// Consume atomically deletes and returns an unexpired ticket. A ticket
+	// can be consumed at most once; afterwards ErrTicketNotFound is
+	// returned.
+	Consume(ctx context.Context, value string) (*Ticket, error)
+
+	// DeleteExpired purges up to limit tickets that expired before the
+	// given time and returns how many rows were removed.
+	DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -18,8 +18,9 @@ func NewSQLStore(db *sql.DB) *SQLStore {
 
 func (s *SQLStore) Create(ctx context.Context, user *User) error {
 	query := `
-		INSERT INTO users (username, password_hash, created_at, last_seen)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (username, username_normalized, password_hash, created_at, last_seen)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (username_normalized) DO NOTHING
 		RETURNING id
 	`
 	// Handle databases that might use ? instead of $1 (like SQLite) by default?
@@ -33,13 +34,16 @@ func (s *SQLStore) Create(ctx context.Context, user *User) error {
 
 	err := s.db.QueryRowContext(ctx, query,
 		user.Username,
+		NormalizeUsername(user.Username),
 		user.PasswordHash,
 		user.CreatedAt,
 		user.LastSeen,
 	).Scan(&user.ID)
 
-	if err != nil {
-		// In a real app, we'd check for unique constraint violation here
+	// No row comes back when the normalized username is already taken.
+	if err == sql.ErrNoRows {
+		return ErrDuplicateUsername
+	} else if err != nil {
 		return err
 	}
 
@@ -47,9 +51,20 @@ func (s *SQLStore) Create(ctx context.Context, user *User) error {
 }
 
 func (s *SQLStore) GetByID(ctx context.Context, id string) (*User, error) {
-	query := `SELECT id, username, password_hash, created_at, last_seen FROM users WHERE id = $1`
+	query := `SELECT id, username, password_hash, created_at, last_seen, totp_secret, totp_enabled FROM users WHERE id = $1`
 
-	row := s.db.QueryRowContext(ctx, query, id)
+	return s.getOne(ctx, query, id)
+}
+
+func (s *SQLStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	query := `SELECT id, username, password_hash, created_at, last_seen, totp_secret, totp_enabled FROM users WHERE username_normalized = $1`
+
+	return s.getOne(ctx, query, NormalizeUsername(username))
+}
+
+// getOne scans a single user row.
+func (s *SQLStore) getOne(ctx context.Context, query string, arg interface{}) (*User, error) {
+	row := s.db.QueryRowContext(ctx, query, arg)
 
 	var user User
 	var lastSeen sql.NullTime // Handle nullable LastSeen
@@ -60,6 +75,8 @@ func (s *SQLStore) GetByID(ctx context.Context, id string) (*User, error) {
 		&user.PasswordHash,
 		&user.CreatedAt,
 		&lastSeen,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
 	)
 
 	if err == sql.ErrNoRows {
@@ -75,39 +92,69 @@ func (s *SQLStore) GetByID(ctx context.Context, id string) (*User, error) {
 	return &user, nil
 }
 
-func (s *SQLStore) GetByUsername(ctx context.Context, username string) (*User, error) {
-	query := `SELECT id, username, password_hash, created_at, last_seen FROM users WHERE username = $1`
+func (s *SQLStore) UpdateLastSeen(ctx context.Context, id string, lastSeen time.Time) error {
+	query := `UPDATE users SET last_seen = $1 WHERE id = $2`
 
-	row := s.db.QueryRowContext(ctx, query, username)
+	result, err := s.db.ExecContext(ctx, query, lastSeen, id)
+	if err != nil {
+		return err
+	}
 
-	var user User
-	var lastSeen sql.NullTime
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
 
-	err := row.Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&lastSeen,
-	)
+	return nil
+}
 
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
-	} else if err != nil {
-		return nil, err
+func (s *SQLStore) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2`
+
+	result, err := s.db.ExecContext(ctx, query, passwordHash, id)
+	if err != nil {
+		return err
 	}
 
-	if lastSeen.Valid {
-		user.LastSeen = lastSeen.Time
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
 	}
 
-	return &user, nil
+	return nil
 }
 
-func (s *SQLStore) UpdateLastSeen(ctx context.Context, id string, lastSeen time.Time) error {
-	query := `UPDATE users SET last_seen = $1 WHERE id = $2`
+func (s *SQLStore) ChangePassword(ctx context.Context, id, passwordHash string) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
 
-	result, err := s.db.ExecContext(ctx, query, lastSeen, id)
+	if err = updatePassword(ctx, tx, id, passwordHash); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updatePassword sets the password hash of user id within tx.
+func updatePassword(ctx context.Context, tx *sql.Tx, id, passwordHash string) error {
+	result, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, passwordHash, id)
 	if err != nil {
 		return err
 	}
@@ -122,3 +169,270 @@ func (s *SQLStore) UpdateLastSeen(ctx context.Context, id string, lastSeen time.
 
 	return nil
 }
+
+func (s *SQLStore) SetTOTPSecret(ctx context.Context, id, secret string) error {
+	query := `UPDATE users SET totp_secret = $1, totp_last_step = 0 WHERE id = $2 AND NOT totp_enabled`
+
+	result, err := s.db.ExecContext(ctx, query, secret, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	return nil
+}
+
+func (s *SQLStore) EnableTOTP(ctx context.Context, id string, step int64, recoveryCodes []string) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	enable := `UPDATE users SET totp_enabled = TRUE, totp_last_step = $1 WHERE id = $2 AND totp_secret <> '' AND NOT totp_enabled`
+	result, err := tx.ExecContext(ctx, enable, step, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		err = ErrTOTPAlreadyEnabled
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, id); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	insert := `INSERT INTO recovery_codes (code_hash, user_id, created_at) VALUES ($1, $2, $3)`
+	for _, code := range recoveryCodes {
+		if _, err = tx.ExecContext(ctx, insert, hashSecret(code), id, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) DisableTOTP(ctx context.Context, id string) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	disable := `UPDATE users SET totp_secret = '', totp_enabled = FALSE, totp_last_step = 0 WHERE id = $1`
+	result, err := tx.ExecContext(ctx, disable, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		err = ErrUserNotFound
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) UseTOTPStep(ctx context.Context, id string, step int64) error {
+	query := `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`
+
+	result, err := s.db.ExecContext(ctx, query, step, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTOTPCodeReused
+	}
+
+	return nil
+}
+
+func (s *SQLStore) ConsumeRecoveryCode(ctx context.Context, id, code string) error {
+	query := `UPDATE recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`
+
+	result, err := s.db.ExecContext(ctx, query, time.Now(), id, hashSecret(code))
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+
+	return nil
+}
+
+func (s *SQLStore) CreateLoginChallenge(ctx context.Context, c *LoginChallenge) error {
+	query := `
+		INSERT INTO login_challenges (token_hash, user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+
+	_, err := s.db.ExecContext(ctx, query, hashSecret(c.Token), c.UserID, c.CreatedAt, c.ExpiresAt)
+	return err
+}
+
+func (s *SQLStore) GetLoginChallenge(ctx context.Context, token string) (*LoginChallenge, error) {
+	query := `
+		SELECT user_id, created_at, expires_at
+		FROM login_challenges
+		WHERE token_hash = $1 AND expires_at > $2
+	`
+
+	var c LoginChallenge
+	err := s.db.QueryRowContext(ctx, query, hashSecret(token), time.Now()).Scan(&c.UserID, &c.CreatedAt, &c.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrChallengeNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (s *SQLStore) DeleteLoginChallenge(ctx context.Context, token string) error {
+	query := `DELETE FROM login_challenges WHERE token_hash = $1`
+
+	result, err := s.db.ExecContext(ctx, query, hashSecret(token))
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrChallengeNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLStore) DeleteExpiredLoginChallenges(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM login_challenges
+		WHERE token_hash IN (
+			SELECT token_hash FROM login_challenges WHERE expires_at < $1 LIMIT $2
+		)
+	`
+
+	result, err := s.db.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *SQLStore) CreatePasswordReset(ctx context.Context, reset *PasswordReset) error {
+	query := `
+		INSERT INTO password_resets (token_hash, user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	if reset.CreatedAt.IsZero() {
+		reset.CreatedAt = time.Now()
+	}
+
+	_, err := s.db.ExecContext(ctx, query, hashSecret(reset.Token), reset.UserID, reset.CreatedAt, reset.ExpiresAt)
+	return err
+}
+
+func (s *SQLStore) ResetPassword(ctx context.Context, token, passwordHash string) (_ *PasswordReset, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	consume := `
+		DELETE FROM password_resets
+		WHERE token_hash = $1 AND expires_at > $2
+		RETURNING user_id, created_at, expires_at
+	`
+
+	var reset PasswordReset
+	err = tx.QueryRowContext(ctx, consume, hashSecret(token), time.Now()).Scan(&reset.UserID, &reset.CreatedAt, &reset.ExpiresAt)
+	if err == sql.ErrNoRows {
+		err = ErrResetTokenInvalid
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = $1`, reset.UserID); err != nil {
+		return nil, err
+	}
+
+	if err = updatePassword(ctx, tx, reset.UserID, passwordHash); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &reset, nil
+}
+
+func (s *SQLStore) DeleteExpiredPasswordResets(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM password_resets
+		WHERE token_hash IN (
+			SELECT token_hash FROM password_resets WHERE expires_at < $1 LIMIT $2
+		)
+	`
+
+	result, err := s.db.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -34,8 +34,9 @@ func TestCreate(t *testing.T) {
 	}
 
 	// Expectation
-	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users (username, password_hash, created_at, last_seen) VALUES ($1, $2, $3, $4) RETURNING id`)).
-		WithArgs(u.Username, u.PasswordHash, u.CreatedAt, u.LastSeen).
+	query := regexp.QuoteMeta(`INSERT INTO users (username, username_normalized, password_hash, created_at, last_seen) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (username_normalized) DO NOTHING RETURNING id`)
+	mock.ExpectQuery(query).
+		WithArgs(u.Username, "testuser", u.PasswordHash, u.CreatedAt, u.LastSeen).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(u.ID))
 
 	err = store.Create(ctx, u)
@@ -43,6 +44,16 @@ func TestCreate(t *testing.T) {
 		t.Errorf("error was not expected while updating stats: %s", err)
 	}
 
+	// Duplicate Case: same name in another letter case
+	dup := &User{Username: "TestUser", PasswordHash: "hashedsecret", CreatedAt: fixedTime, LastSeen: fixedTime}
+	mock.ExpectQuery(query).
+		WithArgs(dup.Username, "testuser", dup.PasswordHash, dup.CreatedAt, dup.LastSeen).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	if err := store.Create(ctx, dup); err != ErrDuplicateUsername {
+		t.Errorf("expected ErrDuplicateUsername, got %v", err)
+	}
+
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
@@ -66,10 +77,10 @@ func TestGetByID(t *testing.T) {
 	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
 
 	// Success Case
-	rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "created_at", "last_seen"}).
-		AddRow(userID, "testuser", "hashedsecret", fixedTime, fixedTime)
+	rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "created_at", "last_seen", "totp_secret", "totp_enabled"}).
+		AddRow(userID, "testuser", "hashedsecret", fixedTime, fixedTime, "", false)
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password_hash, created_at, last_seen FROM users WHERE id = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password_hash, created_at, last_seen, totp_secret, totp_enabled FROM users WHERE id = $1`)).
 		WithArgs(userID).
 		WillReturnRows(rows)
 
@@ -84,7 +95,7 @@ func TestGetByID(t *testing.T) {
 	}
 
 	// Not Found Case
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password_hash, created_at, last_seen FROM users WHERE id = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password_hash, created_at, last_seen, totp_secret, totp_enabled FROM users WHERE id = $1`)).
 		WithArgs("unknown").
 		WillReturnError(sql.ErrNoRows)
 
@@ -116,14 +127,14 @@ func TestGetByUsername(t *testing.T) {
 	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
 
 	// Success Case
-	rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "created_at", "last_seen"}).
-		AddRow("user-123", username, "hashedsecret", fixedTime, fixedTime)
+	rows := sqlmock.NewRows([]string{"id", "username", "password_hash", "created_at", "last_seen", "totp_secret", "totp_enabled"}).
+		AddRow("user-123", username, "hashedsecret", fixedTime, fixedTime, "JBSWY3DPEHPK3PXP", true)
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password_hash, created_at, last_seen FROM users WHERE username = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password_hash, created_at, last_seen, totp_secret, totp_enabled FROM users WHERE username_normalized = $1`)).
 		WithArgs(username).
 		WillReturnRows(rows)
 
-	u, err := store.GetByUsername(ctx, username)
+	u, err := store.GetByUsername(ctx, "TestUser")
 	if err != nil {
 		t.Errorf("error was not expected: %s", err)
 	}
@@ -131,6 +142,8 @@ func TestGetByUsername(t *testing.T) {
 		t.Errorf("expected user, got nil")
 	} else if u.Username != username {
 		t.Errorf("expected username %s, got %s", username, u.Username)
+	} else if !u.TOTPEnabled || u.TOTPSecret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("expected TOTP to be enabled with its secret, got %+v", u)
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -179,3 +192,392 @@ func TestUpdateLastSeen(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestSetTOTPSecret(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	query := regexp.QuoteMeta(`UPDATE users SET totp_secret = $1, totp_last_step = 0 WHERE id = $2 AND NOT totp_enabled`)
+
+	// Success Case
+	mock.ExpectExec(query).
+		WithArgs("SECRET", "user-123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.SetTOTPSecret(ctx, "user-123", "SECRET"); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	// Already Enabled Case
+	mock.ExpectExec(query).
+		WithArgs("SECRET", "user-123").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.SetTOTPSecret(ctx, "user-123", "SECRET"); err != ErrTOTPAlreadyEnabled {
+		t.Errorf("expected ErrTOTPAlreadyEnabled, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEnableTOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET totp_enabled = TRUE, totp_last_step = $1 WHERE id = $2 AND totp_secret <> '' AND NOT totp_enabled`)).
+		WithArgs(int64(1000), "user-123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM recovery_codes WHERE user_id = $1`)).
+		WithArgs("user-123").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, code := range []string{"AAAA-BBBB", "CCCC-DDDD"} {
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO recovery_codes (code_hash, user_id, created_at) VALUES ($1, $2, $3)`)).
+			WithArgs(hashSecret(code), "user-123", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	if err := store.EnableTOTP(ctx, "user-123", 1000, []string{"AAAA-BBBB", "CCCC-DDDD"}); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	query := regexp.QuoteMeta(`UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`)
+
+	// Success Case
+	mock.ExpectExec(query).
+		WithArgs(int64(1001), "user-123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.UseTOTPStep(ctx, "user-123", 1001); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	// Replay Case
+	mock.ExpectExec(query).
+		WithArgs(int64(1001), "user-123").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.UseTOTPStep(ctx, "user-123", 1001); err != ErrTOTPCodeReused {
+		t.Errorf("expected ErrTOTPCodeReused, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestConsumeRecoveryCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	query := regexp.QuoteMeta(`UPDATE recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`)
+
+	// Success Case
+	mock.ExpectExec(query).
+		WithArgs(sqlmock.AnyArg(), "user-123", hashSecret("AAAA-BBBB")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.ConsumeRecoveryCode(ctx, "user-123", "AAAA-BBBB"); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	// Spent Case
+	mock.ExpectExec(query).
+		WithArgs(sqlmock.AnyArg(), "user-123", hashSecret("AAAA-BBBB")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.ConsumeRecoveryCode(ctx, "user-123", "AAAA-BBBB"); err != ErrRecoveryCodeInvalid {
+		t.Errorf("expected ErrRecoveryCodeInvalid, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLoginChallenge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := &LoginChallenge{
+		Token:     "challenge-abc",
+		UserID:    "user-123",
+		CreatedAt: fixedTime,
+		ExpiresAt: fixedTime.Add(5 * time.Minute),
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO login_challenges (token_hash, user_id, created_at, expires_at) VALUES ($1, $2, $3, $4)`)).
+		WithArgs(hashSecret(c.Token), c.UserID, c.CreatedAt, c.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.CreateLoginChallenge(ctx, c); err != nil {
+		t.Errorf("error was not expected while creating challenge: %s", err)
+	}
+
+	get := regexp.QuoteMeta(`SELECT user_id, created_at, expires_at FROM login_challenges WHERE token_hash = $1 AND expires_at > $2`)
+	mock.ExpectQuery(get).
+		WithArgs(hashSecret(c.Token), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "created_at", "expires_at"}).
+			AddRow(c.UserID, c.CreatedAt, c.ExpiresAt))
+
+	got, err := store.GetLoginChallenge(ctx, c.Token)
+	if err != nil {
+		t.Errorf("error was not expected while getting challenge: %s", err)
+	}
+	if got == nil || got.UserID != c.UserID {
+		t.Errorf("expected challenge for %s, got %+v", c.UserID, got)
+	}
+
+	del := regexp.QuoteMeta(`DELETE FROM login_challenges WHERE token_hash = $1`)
+	mock.ExpectExec(del).
+		WithArgs(hashSecret(c.Token)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(del).
+		WithArgs(hashSecret(c.Token)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.DeleteLoginChallenge(ctx, c.Token); err != nil {
+		t.Errorf("error was not expected while deleting challenge: %s", err)
+	}
+	if err := store.DeleteLoginChallenge(ctx, c.Token); err != ErrChallengeNotFound {
+		t.Errorf("expected ErrChallengeNotFound on second delete, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdatePassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	query := regexp.QuoteMeta(`UPDATE users SET password_hash = $1 WHERE id = $2`)
+
+	// Success Case
+	mock.ExpectExec(query).
+		WithArgs("newhash", "user-123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.UpdatePassword(ctx, "user-123", "newhash"); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	// Not Found Case
+	mock.ExpectExec(query).
+		WithArgs("newhash", "unknown").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.UpdatePassword(ctx, "unknown", "newhash"); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	update := regexp.QuoteMeta(`UPDATE users SET password_hash = $1 WHERE id = $2`)
+
+	// Success Case: outstanding reset tokens are invalidated.
+	mock.ExpectBegin()
+	mock.ExpectExec(update).
+		WithArgs("newhash", "user-123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM password_resets WHERE user_id = $1`)).
+		WithArgs("user-123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := store.ChangePassword(ctx, "user-123", "newhash"); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+
+	// Not Found Case
+	mock.ExpectBegin()
+	mock.ExpectExec(update).
+		WithArgs("newhash", "unknown").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	if err := store.ChangePassword(ctx, "unknown", "newhash"); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("error closing db: %v", closeErr)
+		}
+	}()
+
+	store := NewSQLStore(db)
+	ctx := context.Background()
+
+	fixedTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	reset := &PasswordReset{
+		Token:     "reset-abc",
+		UserID:    "user-123",
+		CreatedAt: fixedTime,
+		ExpiresAt: fixedTime.Add(time.Hour),
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO password_resets (token_hash, user_id, created_at, expires_at) VALUES ($1, $2, $3, $4)`)).
+		WithArgs(hashSecret(reset.Token), reset.UserID, reset.CreatedAt, reset.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := store.CreatePasswordReset(ctx, reset); err != nil {
+		t.Errorf("error was not expected while creating reset: %s", err)
+	}
+
+	consume := regexp.QuoteMeta(`DELETE FROM password_resets WHERE token_hash = $1 AND expires_at > $2 RETURNING user_id, created_at, expires_at`)
+
+	// Success Case: the user's other tokens are invalidated too.
+	mock.ExpectBegin()
+	mock.ExpectQuery(consume).
+		WithArgs(hashSecret(reset.Token), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "created_at", "expires_at"}).
+			AddRow(reset.UserID, reset.CreatedAt, reset.ExpiresAt))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM password_resets WHERE user_id = $1`)).
+		WithArgs(reset.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET password_hash = $1 WHERE id = $2`)).
+		WithArgs("newhash", reset.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	got, err := store.ResetPassword(ctx, reset.Token, "newhash")
+	if err != nil {
+		t.Errorf("error was not expected while consuming reset: %s", err)
+	}
+	if got == nil || got.UserID != reset.UserID {
+		t.Errorf("expected reset for %s, got %+v", reset.UserID, got)
+	}
+
+	// Spent Case
+	mock.ExpectBegin()
+	mock.ExpectQuery(consume).
+		WithArgs(hashSecret(reset.Token), sqlmock.AnyArg()).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	if _, err := store.ResetPassword(ctx, reset.Token, "newhash"); err != ErrResetTokenInvalid {
+		t.Errorf("expected ErrResetTokenInvalid, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Alice", "alice"},
+		{"bob_2.X-Y", "bob_2.x-y"},
+		{"ÄNNE", "Änne"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeUsername(tt.in); got != tt.want {
+			t.Errorf("NormalizeUsername(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package user
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"time"
 )
@@ -13,24 +15,138 @@ type User struct {
 	PasswordHash string    `json:"-"` // Never export password hash to JSON
 	CreatedAt    time.Time `json:"created_at"`
 	LastSeen     time.Time `json:"last_seen"`
+
+	// TOTPSecret is the shared TOTP secret. It is set during enrollment
+	// and only takes effect once TOTPEnabled is true.
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+}
+
+// LoginChallenge is issued after a correct password for an account with
+// two-factor authentication, and is exchanged for a session together with a
+// second factor.
+type LoginChallenge struct {
+	// Token is the plaintext challenge token. It is only populated when a
+	// challenge is created; the store keeps a hash.
+	Token     string    `json:"-"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PasswordReset is a single-use token that lets a user set a new password
+// without knowing the current one.
+type PasswordReset struct {
+	// Token is the plaintext reset token. It is only populated when a reset
+	// is created; the store keeps a hash.
+	Token     string    `json:"-"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 var (
-	ErrUserNotFound      = errors.New("user not found")
-	ErrDuplicateUsername = errors.New("username already exists")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrDuplicateUsername   = errors.New("username already exists")
+	ErrTOTPAlreadyEnabled  = errors.New("two-factor authentication already enabled")
+	ErrTOTPCodeReused      = errors.New("totp code already used")
+	ErrRecoveryCodeInvalid = errors.New("recovery code invalid")
+	ErrChallengeNotFound   = errors.New("login challenge not found")
+	ErrResetTokenInvalid   = errors.New("password reset token invalid")
 )
 
 // Store defines the interface for CRUD operations on User accounts.
 type Store interface {
-	// CreateUser inserts a new user into the store.
+	// CreateUser inserts a new user into the store. It returns
+	// ErrDuplicateUsername if the username is taken in any letter case.
 	Create(ctx context.Context, user *User) error
 
 	// GetByID retrieves a user by their unique ID.
 	GetByID(ctx context.Context, id string) (*User, error)
 
-	// GetByUsername retrieves a user by their username.
+	// GetByUsername retrieves a user by their username, ignoring case.
 	GetByUsername(ctx context.Context, username string) (*User, error)
 
 	// UpdateLastSeen updates the LastSeen timestamp for a user.
 	UpdateLastSeen(ctx context.Context, id string, lastSeen time.Time) error
+
+	// UpdatePassword replaces the user's password hash, e.g. to upgrade it
+	// to current hashing parameters.
+	UpdatePassword(ctx context.Context, id, passwordHash string) error
+
+	// ChangePassword sets a new password hash and invalidates the user's
+	// outstanding reset tokens, so that a leaked token stops working once
+	// the password has been changed.
+	ChangePassword(ctx context.Context, id, passwordHash string) error
+
+	// CreatePasswordReset stores a pending password reset.
+	CreatePasswordReset(ctx context.Context, reset *PasswordReset) error
+
+	// ResetPassword redeems an unexpired reset token and sets the new
+	// password hash in the same transaction, so the token is only spent if
+	// the password changes. All of the user's outstanding reset tokens are
+	// invalidated with it. It returns ErrResetTokenInvalid if the token is
+	// unknown, spent or expired.
+	ResetPassword(ctx context.Context, token, passwordHash string) (*PasswordReset, error)
+
+	// DeleteExpiredPasswordResets purges up to limit reset tokens that
+	// expired before the given time and returns how many were removed.
+	DeleteExpiredPasswordResets(ctx context.Context, before time.Time, limit int) (int64, error)
+
+	// SetTOTPSecret starts TOTP enrollment by storing a pending secret. It
+	// returns ErrTOTPAlreadyEnabled if the user has already completed
+	// enrollment.
+	SetTOTPSecret(ctx context.Context, id, secret string) error
+
+	// EnableTOTP completes enrollment once the user proved possession of
+	// the pending secret with a code from step. Any previous recovery codes
+	// are replaced with recoveryCodes.
+	EnableTOTP(ctx context.Context, id string, step int64, recoveryCodes []string) error
+
+	// DisableTOTP turns two-factor authentication off and discards the
+	// secret and recovery codes.
+	DisableTOTP(ctx context.Context, id string) error
+
+	// UseTOTPStep records that a code from step was accepted. It returns
+	// ErrTOTPCodeReused if that step, or a later one, was already used.
+	UseTOTPStep(ctx context.Context, id string, step int64) error
+
+	// ConsumeRecoveryCode marks one of the user's recovery codes as used.
+	// It returns ErrRecoveryCodeInvalid if the code is unknown or spent.
+	ConsumeRecoveryCode(ctx context.Context, id, code string) error
+
+	// CreateLoginChallenge stores a pending second-factor challenge.
+	CreateLoginChallenge(ctx context.Context, challenge *LoginChallenge) error
+
+	// GetLoginChallenge returns an unexpired challenge by its token.
+	GetLoginChallenge(ctx context.Context, token string) (*LoginChallenge, error)
+
+	// DeleteLoginChallenge removes a challenge once it has been answered.
+	// It returns ErrChallengeNotFound if it was already removed, so that a
+	// challenge can only be redeemed once.
+	DeleteLoginChallenge(ctx context.Context, token string) error
+
+	// DeleteExpiredLoginChallenges purges up to limit challenges that
+	// expired before the given time and returns how many were removed.
+	DeleteExpiredLoginChallenges(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// NormalizeUsername returns the form of a username that uniqueness and
+// lookups are based on. Only ASCII letters are lowered, so that the result
+// matches the backfill in migration 014 whatever the database locale.
+func NormalizeUsername(username string) string {
+	b := []byte(username)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// hashSecret returns the form in which recovery codes, challenge tokens and
+// reset tokens are persisted.
+func hashSecret(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/nexus-im/nexus/store/event"
+)
+
+// maxReplayEvents caps how many missed events are replayed on reconnect.
+// A client that is further behind is told to resync from the REST API.
+const maxReplayEvents = 1000
+
+// streamPositionPayload tells a client where its event stream stands.
+type streamPositionPayload struct {
+	LatestSeq int64 `json:"latest_seq"`
+}
+
+// streamLocks holds one lock per user with events in flight. A user's lock
+// is held from numbering an event to handing it to the run loop, so every
+// connection receives the user's events in sequence order and no event can
+// slip between a reconnect's replay and its registration. Users who share
+// no event never wait for each other.
+type streamLocks struct {
+	mu    sync.Mutex
+	locks map[string]*streamLock
+}
+
+type streamLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock acquires the locks of userIDs and returns a function releasing them.
+// Locks are taken in sorted order so that events for overlapping sets of
+// users cannot deadlock.
+func (l *streamLocks) lock(userIDs []string) (unlock func()) {
+	ids := append([]string(nil), userIDs...)
+	sort.Strings(ids)
+
+	held := make([]string, 0, len(ids))
+	locks := make([]*streamLock, 0, len(ids))
+	for i, id := range ids {
+		if i > 0 && id == ids[i-1] {
+			continue
+		}
+		l.mu.Lock()
+		if l.locks == nil {
+			l.locks = make(map[string]*streamLock)
+		}
+		sl, ok := l.locks[id]
+		if !ok {
+			sl = &streamLock{}
+			l.locks[id] = sl
+		}
+		sl.refs++
+		l.mu.Unlock()
+
+		sl.Lock()
+		held = append(held, id)
+		locks = append(locks, sl)
+	}
+
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+			l.mu.Lock()
+			if locks[i].refs--; locks[i].refs == 0 {
+				delete(l.locks, held[i])
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// publish stores an event in the stream of each of userIDs and delivers it
+// to their live connections, stamped with each user's sequence number. If
+// the event cannot be stored, a live event without a number would break the
+// stream's continuity, so the users' connections are told to resync instead
+// and the error is returned.
+func (h *Hub) publish(ctx context.Context, userIDs []string, eventType string, payload interface{}) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	unlock := h.streams.lock(userIDs)
+	defer unlock()
+
+	seqs, err := eventStore.Append(ctx, userIDs, eventType, raw)
+	if err != nil {
+		h.requestResync(ctx, userIDs)
+		return err
+	}
+
+	for userID, seq := range seqs {
+		out, err := json.Marshal(envelope{Type: eventType, Seq: seq, Payload: raw})
+		if err != nil {
+			return err
+		}
+		h.deliver <- &delivery{userIDs: []string{userID}, message: out}
+	}
+	return nil
+}
+
+// requestResync sends resync_required to the live connections of userIDs,
+// whose streams are missing an event. The caller holds their stream locks.
+func (h *Hub) requestResync(ctx context.Context, userIDs []string) {
+	for _, userID := range userIDs {
+		latest, err := eventStore.LastSeq(ctx, userID)
+		if err != nil {
+			log.Printf("error loading stream position of %s: %v", userID, err)
+			continue
+		}
+		out, err := encodeEvent(eventResyncRequired, streamPositionPayload{LatestSeq: latest})
+		if err != nil {
+			log.Printf("error encoding resync_required: %v", err)
+			continue
+		}
+		h.deliver <- &delivery{userIDs: []string{userID}, message: out}
+	}
+}
+
+// planReplay decides how a connection resuming after since catches up with
+// a stream whose latest sequence number is latest. events are the stored
+// events following since, loaded up to maxReplayEvents+1 of them. It
+// returns the events to replay, or resync if the client must instead reload
+// its state from the REST API.
+func planReplay(since, latest int64, events []*event.Event) (replay []*event.Event, resync bool) {
+	switch {
+	case since == latest:
+		return nil, false
+	case since > latest:
+		// The client is ahead of the server, so its state cannot be trusted.
+		return nil, true
+	case len(events) == 0 || events[0].Seq != since+1 || len(events) > maxReplayEvents:
+		// Part of the gap has been purged, or it is too long to replay.
+		return nil, true
+	}
+	return events, false
+}
+
+// connect registers a new connection. If resume is set, the events the
+// user missed after since are queued ahead of any live traffic, or
+// resync_required is sent if they are no longer all available. Either way
+// the connection is then told the latest sequence number.
+func (h *Hub) connect(ctx context.Context, c *Client, since int64, resume bool) error {
+	unlock := h.streams.lock([]string{c.userID})
+	defer unlock()
+
+	latest, err := eventStore.LastSeq(ctx, c.userID)
+	if err != nil {
+		return err
+	}
+
+	var frames [][]byte
+	if resume {
+		var events []*event.Event
+		if since < latest {
+			events, err = eventStore.ListSince(ctx, c.userID, since, maxReplayEvents+1)
+			if err != nil {
+				return err
+			}
+		}
+
+		replay, resync := planReplay(since, latest, events)
+		if resync {
+			out, err := encodeEvent(eventResyncRequired, streamPositionPayload{LatestSeq: latest})
+			if err != nil {
+				return err
+			}
+			frames = append(frames, out)
+		}
+		for _, e := range replay {
+			out, err := json.Marshal(envelope{Type: e.Type, Seq: e.Seq, Payload: e.Payload})
+			if err != nil {
+				return err
+			}
+			frames = append(frames, out)
+		}
+	}
+
+	out, err := encodeEvent(eventReplayComplete, streamPositionPayload{LatestSeq: latest})
+	if err != nil {
+		return err
+	}
+	frames = append(frames, out)
+
+	// Size the buffer so that the replay never trips the slow-client check.
+	c.send = make(chan []byte, len(frames)+sendBufferSize)
+	for _, f := range frames {
+		c.send <- f
+	}
+	h.register <- c
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nexus-im/nexus/store/event"
+)
+
+// eventRange returns events numbered from through to.
+func eventRange(from, to int64) []*event.Event {
+	var events []*event.Event
+	for seq := from; seq <= to; seq++ {
+		events = append(events, &event.Event{UserID: "user-1", Seq: seq, Type: eventMessageDelivered, Payload: json.RawMessage(`{}`)})
+	}
+	return events
+}
+
+func TestPlanReplay(t *testing.T) {
+	tests := []struct {
+		name          string
+		since, latest int64
+		events        []*event.Event
+		wantReplay    int
+		wantResync    bool
+	}{
+		{"up to date", 5, 5, nil, 0, false},
+		{"new user", 0, 0, nil, 0, false},
+		{"small gap", 5, 8, eventRange(6, 8), 3, false},
+		{"from the start", 0, 3, eventRange(1, 3), 3, false},
+		{"gap partly purged", 5, 8, eventRange(7, 8), 0, true},
+		{"gap fully purged", 5, 8, nil, 0, true},
+		{"exactly the limit", 0, maxReplayEvents, eventRange(1, maxReplayEvents), maxReplayEvents, false},
+		{"over the limit", 0, maxReplayEvents + 5, eventRange(1, maxReplayEvents+1), 0, true},
+		{"client ahead", 9, 8, nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replay, resync := planReplay(tt.since, tt.latest, tt.events)
+			if resync != tt.wantResync || len(replay) != tt.wantReplay {
+				t.Errorf("got %d events, resync %v; want %d events, resync %v",
+					len(replay), resync, tt.wantReplay, tt.wantResync)
+			}
+		})
+	}
+}
+
+// fakeEventStore serves a fixed stream for one user.
+type fakeEventStore struct {
+	latest    int64
+	events    []*event.Event
+	appendErr error
+}
+
+func (s *fakeEventStore) Append(ctx context.Context, userIDs []string, eventType string, payload json.RawMessage) (map[string]int64, error) {
+	if s.appendErr != nil {
+		return nil, s.appendErr
+	}
+	seqs := make(map[string]int64)
+	for _, id := range userIDs {
+		seqs[id] = s.latest + 1
+	}
+	return seqs, nil
+}
+
+func (s *fakeEventStore) LastSeq(ctx context.Context, userID string) (int64, error) {
+	return s.latest, nil
+}
+
+func (s *fakeEventStore) ListSince(ctx context.Context, userID string, since int64, limit int) ([]*event.Event, error) {
+	var out []*event.Event
+	for _, e := range s.events {
+		if e.Seq > since && len(out) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (s *fakeEventStore) DeleteBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return 0, nil
+}
+
+func TestConnect(t *testing.T) {
+	saved := eventStore
+	defer func() { eventStore = saved }()
+
+	tests := []struct {
+		name   string
+		store  *fakeEventStore
+		since  int64
+		resume bool
+		want   []string
+	}{
+		{"fresh connection", &fakeEventStore{latest: 8, events: eventRange(1, 8)}, 0, false,
+			[]string{eventReplayComplete}},
+		{"resume with gap", &fakeEventStore{latest: 8, events: eventRange(1, 8)}, 6, true,
+			[]string{eventMessageDelivered, eventMessageDelivered, eventReplayComplete}},
+		{"resume up to date", &fakeEventStore{latest: 8, events: eventRange(1, 8)}, 8, true,
+			[]string{eventReplayComplete}},
+		{"resume after purge", &fakeEventStore{latest: 8, events: eventRange(5, 8)}, 2, true,
+			[]string{eventResyncRequired, eventReplayComplete}},
+		{"resume ahead", &fakeEventStore{latest: 8, events: eventRange(1, 8)}, 20, true,
+			[]string{eventResyncRequired, eventReplayComplete}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventStore = tt.store
+			h := &Hub{register: make(chan *Client, 1)}
+			c := &Client{hub: h, userID: "user-1"}
+
+			if err := h.connect(context.Background(), c, tt.since, tt.resume); err != nil {
+				t.Fatalf("connect: %v", err)
+			}
+			if got := <-h.register; got != c {
+				t.Fatal("connection was not registered")
+			}
+
+			var got []string
+			var seqs []int64
+			for len(c.send) > 0 {
+				var env envelope
+				if err := json.Unmarshal(<-c.send, &env); err != nil {
+					t.Fatalf("malformed frame: %v", err)
+				}
+				got = append(got, env.Type)
+				if env.Seq != 0 {
+					seqs = append(seqs, env.Seq)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got frames %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got frames %v, want %v", got, tt.want)
+				}
+			}
+			for i, seq := range seqs {
+				if seq != tt.since+int64(i)+1 {
+					t.Errorf("replayed seqs %v do not follow %d", seqs, tt.since)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	saved := eventStore
+	defer func() { eventStore = saved }()
+
+	tests := []struct {
+		name     string
+		store    *fakeEventStore
+		wantErr  bool
+		wantType string
+		wantSeq  int64
+	}{
+		{"stored", &fakeEventStore{latest: 4}, false, eventMessageDelivered, 5},
+		{"append fails", &fakeEventStore{latest: 4, appendErr: errors.New("connection refused")}, true, eventResyncRequired, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventStore = tt.store
+			h := &Hub{deliver: make(chan *delivery, 2)}
+
+			err := h.publish(context.Background(), []string{"user-1"}, eventMessageDelivered, map[string]string{"message_id": "m"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("publish error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(h.deliver) != 1 {
+				t.Fatalf("expected one delivery, got %d", len(h.deliver))
+			}
+
+			d := <-h.deliver
+			var env envelope
+			if err := json.Unmarshal(d.message, &env); err != nil {
+				t.Fatalf("malformed frame: %v", err)
+			}
+			if env.Type != tt.wantType || env.Seq != tt.wantSeq {
+				t.Errorf("got %s seq %d, want %s seq %d", env.Type, env.Seq, tt.wantType, tt.wantSeq)
+			}
+			if len(d.userIDs) != 1 || d.userIDs[0] != "user-1" {
+				t.Errorf("delivered to %v, want [user-1]", d.userIDs)
+			}
+		})
+	}
+}
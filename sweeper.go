@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+)
+
+// gcStats exposes sweeper activity on /debug/vars of the -debug-addr
+// listener.
+var gcStats = expvar.NewMap("gc")
+
+// sweeper periodically purges sessions, connect tickets, login challenges
+// and password reset tokens that have expired, and stream events older than
+// the retention period. Deletes are issued in batches so that a large
+// backlog never holds locks on a table for long.
+type sweeper struct {
+	interval       time.Duration
+	batchSize      int
+	eventRetention time.Duration
+}
+
+func (s *sweeper) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.sweep(context.Background())
+		<-ticker.C
+	}
+}
+
+func (s *sweeper) sweep(ctx context.Context) {
+	now := time.Now()
+	gcStats.Add("runs", 1)
+
+	sessions, err := s.purge(ctx, func(ctx context.Context) (int64, error) {
+		return sessionStore.DeleteExpired(ctx, now, s.batchSize)
+	})
+	gcStats.Add("sessions_purged", sessions)
+	if err != nil {
+		gcStats.Add("errors", 1)
+		log.Printf("gc: error purging sessions: %v", err)
+	}
+
+	tickets, err := s.purge(ctx, func(ctx context.Context) (int64, error) {
+		return ticketStore.DeleteExpired(ctx, now, s.batchSize)
+	})
+	gcStats.Add("tickets_purged", tickets)
+	if err != nil {
+		gcStats.Add("errors", 1)
+		log.Printf("gc: error purging ws tickets: %v", err)
+	}
+
+	challenges, err := s.purge(ctx, func(ctx context.Context) (int64, error) {
+		return userStore.DeleteExpiredLoginChallenges(ctx, now, s.batchSize)
+	})
+	gcStats.Add("challenges_purged", challenges)
+	if err != nil {
+		gcStats.Add("errors", 1)
+		log.Printf("gc: error purging login challenges: %v", err)
+	}
+
+	resets, err := s.purge(ctx, func(ctx context.Context) (int64, error) {
+		return userStore.DeleteExpiredPasswordResets(ctx, now, s.batchSize)
+	})
+	gcStats.Add("resets_purged", resets)
+	if err != nil {
+		gcStats.Add("errors", 1)
+		log.Printf("gc: error purging password resets: %v", err)
+	}
+
+	events, err := s.purge(ctx, func(ctx context.Context) (int64, error) {
+		return eventStore.DeleteBefore(ctx, now.Add(-s.eventRetention), s.batchSize)
+	})
+	gcStats.Add("events_purged", events)
+	if err != nil {
+		gcStats.Add("errors", 1)
+		log.Printf("gc: error purging stream events: %v", err)
+	}
+
+	if sessions > 0 || tickets > 0 || challenges > 0 || resets > 0 || events > 0 {
+		log.Printf("gc: purged %d sessions, %d ws tickets, %d login challenges, %d password resets and %d stream events",
+			sessions, tickets, challenges, resets, events)
+	}
+}
+
+// purge calls deleteBatch until it removes fewer rows than a full batch.
+func (s *sweeper) purge(ctx context.Context, deleteBatch func(context.Context) (int64, error)) (int64, error) {
+	var total int64
+	for {
+		n, err := deleteBatch(ctx)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < int64(s.batchSize) {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/nexus-im/nexus/store/event"
+	"github.com/nexus-im/nexus/store/session"
+	"github.com/nexus-im/nexus/store/ticket"
+	"github.com/nexus-im/nexus/store/user"
+)
+
+// batchDeleter returns preset batch sizes, then 0 or err once they run out.
+type batchDeleter struct {
+	batches []int64
+	err     error
+	calls   int
+	before  time.Time
+}
+
+func (d *batchDeleter) delete(before time.Time) (int64, error) {
+	d.calls++
+	d.before = before
+	if len(d.batches) == 0 {
+		return 0, d.err
+	}
+	n := d.batches[0]
+	d.batches = d.batches[1:]
+	return n, nil
+}
+
+type fakeSessionStore struct {
+	session.Store
+	expired *batchDeleter
+}
+
+func (s fakeSessionStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.expired.delete(before)
+}
+
+type fakeTicketStore struct {
+	ticket.Store
+	expired *batchDeleter
+}
+
+func (s fakeTicketStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.expired.delete(before)
+}
+
+type fakeUserStore struct {
+	user.Store
+	challenges *batchDeleter
+	resets     *batchDeleter
+}
+
+func (s fakeUserStore) DeleteExpiredLoginChallenges(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.challenges.delete(before)
+}
+
+func (s fakeUserStore) DeleteExpiredPasswordResets(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.resets.delete(before)
+}
+
+type fakeEventPurger struct {
+	event.Store
+	old *batchDeleter
+}
+
+func (s fakeEventPurger) DeleteBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.old.delete(before)
+}
+
+func TestSweeperPurge(t *testing.T) {
+	failure := errors.New("connection refused")
+
+	tests := []struct {
+		name      string
+		deleter   *batchDeleter
+		wantTotal int64
+		wantCalls int
+		wantErr   error
+	}{
+		{"nothing to do", &batchDeleter{}, 0, 1, nil},
+		{"short batch ends the loop", &batchDeleter{batches: []int64{3, 3, 1}}, 7, 3, nil},
+		{"full batches until empty", &batchDeleter{batches: []int64{3, 3}}, 6, 3, nil},
+		{"error stops the loop", &batchDeleter{batches: []int64{3}, err: failure}, 3, 2, failure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &sweeper{batchSize: 3}
+			total, err := s.purge(context.Background(), func(ctx context.Context) (int64, error) {
+				return tt.deleter.delete(time.Time{})
+			})
+			if total != tt.wantTotal || err != tt.wantErr || tt.deleter.calls != tt.wantCalls {
+				t.Errorf("got total %d, err %v after %d calls; want %d, %v after %d",
+					total, err, tt.deleter.calls, tt.wantTotal, tt.wantErr, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// gcCounter reads one of the sweeper's expvar counters.
+func gcCounter(name string) int64 {
+	if v, ok := gcStats.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestSweep(t *testing.T) {
+	savedSessions, savedTickets, savedUsers, savedEvents := sessionStore, ticketStore, userStore, eventStore
+	defer func() {
+		sessionStore, ticketStore, userStore, eventStore = savedSessions, savedTickets, savedUsers, savedEvents
+	}()
+
+	sessions := &batchDeleter{batches: []int64{2, 2, 1}}
+	tickets := &batchDeleter{}
+	challenges := &batchDeleter{batches: []int64{2}, err: errors.New("connection refused")}
+	resets := &batchDeleter{batches: []int64{1}}
+	events := &batchDeleter{batches: []int64{2}}
+	sessionStore = fakeSessionStore{expired: sessions}
+	ticketStore = fakeTicketStore{expired: tickets}
+	userStore = fakeUserStore{challenges: challenges, resets: resets}
+	eventStore = fakeEventPurger{old: events}
+
+	counters := []string{"runs", "sessions_purged", "tickets_purged", "challenges_purged", "resets_purged", "events_purged", "errors"}
+	before := make(map[string]int64)
+	for _, name := range counters {
+		before[name] = gcCounter(name)
+	}
+
+	s := &sweeper{batchSize: 2, eventRetention: time.Hour}
+	s.sweep(context.Background())
+
+	want := map[string]int64{
+		"runs":              1,
+		"sessions_purged":   5,
+		"tickets_purged":    0,
+		"challenges_purged": 2,
+		"resets_purged":     1,
+		"events_purged":     2,
+		"errors":            1,
+	}
+	for _, name := range counters {
+		if got := gcCounter(name) - before[name]; got != want[name] {
+			t.Errorf("%s increased by %d, want %d", name, got, want[name])
+		}
+	}
+
+	// A failing store must not keep the others from being swept.
+	if resets.calls == 0 || events.calls == 0 {
+		t.Error("stores after the failing one were not swept")
+	}
+	if d := time.Until(events.before.Add(time.Hour)); d > time.Second || d < -time.Second {
+		t.Errorf("events purged before %v, want about an hour ago", events.before)
+	}
+	if !sessions.before.Equal(tickets.before) {
+		t.Error("every store should be swept against the same cutoff")
+	}
+}
@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key from the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFCVectors(t *testing.T) {
+	// The RFC lists 8-digit codes; a 6-digit code is their last 6 digits.
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, v := range vectors {
+		code, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if code != v.code {
+			t.Errorf("T=%d: expected %s, got %s", v.unix, v.code, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := Code(rfcSecret, Step(now))
+
+	step, ok := Validate(rfcSecret, code, now, 1)
+	if !ok || step != Step(now) {
+		t.Errorf("expected current code to validate at step %d, got %d %v", Step(now), step, ok)
+	}
+
+	// One step of drift is tolerated, two are not.
+	if _, ok := Validate(rfcSecret, code, now.Add(Period), 1); !ok {
+		t.Error("expected code from previous step to validate")
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(2*Period), 1); ok {
+		t.Error("expected code from two steps ago to be rejected")
+	}
+
+	if _, ok := Validate(rfcSecret, "12345", now, 1); ok {
+		t.Error("expected short code to be rejected")
+	}
+}
+
+func TestGenerateSecretAndURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("expected 32 base32 characters, got %d", len(secret))
+	}
+
+	uri := URI("Nexus", "alice", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Nexus:alice?") {
+		t.Errorf("unexpected URI prefix: %s", uri)
+	}
+	if !strings.Contains(uri, "secret="+secret) || !strings.Contains(uri, "issuer=Nexus") {
+		t.Errorf("expected secret and issuer in URI: %s", uri)
+	}
+}
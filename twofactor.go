@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nexus-im/nexus/store/user"
+	"github.com/nexus-im/nexus/totp"
+)
+
+const (
+	totpIssuer = "Nexus"
+
+	// totpSkew is how many time steps either side of now are accepted, to
+	// tolerate clock drift on the user's device.
+	totpSkew = 1
+
+	loginChallengeTTL = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var errInvalidSecondFactor = errors.New("invalid second factor")
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// secondFactor is the part of a request body that proves possession of the
+// second factor: either a current TOTP code or an unused recovery code.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// issueLoginChallenge answers a correct password for an account with 2FA
+// enabled. No session is created until the challenge is answered.
+func issueLoginChallenge(w http.ResponseWriter, r *http.Request, u *user.User) {
+	token, err := generateSessionToken()
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	c := &user.LoginChallenge{
+		Token:     token,
+		UserID:    u.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(loginChallengeTTL),
+	}
+	if err := userStore.CreateLoginChallenge(r.Context(), c); err != nil {
+		log.Printf("Error creating login challenge: %v", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"two_factor_required": true,
+		"challenge_token":     token,
+		"expires_in":          int(loginChallengeTTL.Seconds()),
+	})
+}
+
+func handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+		secondFactor
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		http.Error(w, "Challenge token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := userStore.GetLoginChallenge(r.Context(), req.ChallengeToken)
+	if err == user.ErrChallengeNotFound {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("Error loading login challenge: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	u, err := userStore.GetByID(r.Context(), challenge.UserID)
+	if err != nil {
+		log.Printf("Error loading user for login challenge: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ipKey := "ip:" + clientIP(r)
+	userKey := loginUserKey(u.Username)
+	if !allowLoginAttempt(w, r, ipKey, userKey) {
+		return
+	}
+
+	if err := verifySecondFactor(r.Context(), u, req.secondFactor); err != nil {
+		if err == errInvalidSecondFactor {
+			recordLoginFailure(r, ipKey, userKey)
+			http.Error(w, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Error verifying second factor: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Deleting the challenge is what redeems it, so a concurrent request
+	// with the same token cannot also get a session.
+	if err := userStore.DeleteLoginChallenge(r.Context(), req.ChallengeToken); err != nil {
+		if err == user.ErrChallengeNotFound {
+			http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Error deleting login challenge: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := loginUserLimiter.Reset(r.Context(), userKey); err != nil {
+		log.Printf("Error resetting login limiter: %v", err)
+	}
+
+	issueSession(w, r, u.ID)
+}
+
+func handleTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u, err := userStore.GetByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error loading user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// As with disabling, a stolen session alone must not be enough to bind
+	// a second factor the attacker controls and lock the owner out.
+	ipKey := "ip:" + clientIP(r)
+	userKey := loginUserKey(u.Username)
+	if !allowLoginAttempt(w, r, ipKey, userKey) {
+		return
+	}
+	if !checkPassword(w, r, u, req.CurrentPassword, ipKey, userKey) {
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	if err := userStore.SetTOTPSecret(r.Context(), u.ID, secret); err != nil {
+		if err == user.ErrTOTPAlreadyEnabled {
+			http.Error(w, "Two-factor authentication already enabled", http.StatusConflict)
+			return
+		}
+		log.Printf("Error storing totp secret: %v", err)
+		http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, u.Username, secret),
+	})
+}
+
+func handleTwoFactorVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u, err := userStore.GetByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error loading user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if u.TOTPEnabled {
+		http.Error(w, "Two-factor authentication already enabled", http.StatusConflict)
+		return
+	}
+	if u.TOTPSecret == "" {
+		http.Error(w, "Two-factor enrollment not started", http.StatusConflict)
+		return
+	}
+
+	ipKey := "ip:" + clientIP(r)
+	userKey := loginUserKey(u.Username)
+	if !allowLoginAttempt(w, r, ipKey, userKey) {
+		return
+	}
+	if !checkPassword(w, r, u, req.CurrentPassword, ipKey, userKey) {
+		return
+	}
+
+	step, ok := totp.Validate(u.TOTPSecret, strings.TrimSpace(req.Code), time.Now(), totpSkew)
+	if !ok {
+		recordLoginFailure(r, ipKey, userKey)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	if err := userStore.EnableTOTP(r.Context(), u.ID, step, codes); err != nil {
+		if err == user.ErrTOTPAlreadyEnabled {
+			http.Error(w, "Two-factor authentication already enabled", http.StatusConflict)
+			return
+		}
+		log.Printf("Error enabling totp: %v", err)
+		http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+func handleTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := authenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+		secondFactor
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u, err := userStore.GetByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error loading user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !u.TOTPEnabled {
+		http.Error(w, "Two-factor authentication not enabled", http.StatusConflict)
+		return
+	}
+
+	// A stolen session alone must not be enough to strip the second
+	// factor, so both factors are checked again under the login limits.
+	ipKey := "ip:" + clientIP(r)
+	userKey := loginUserKey(u.Username)
+	if !allowLoginAttempt(w, r, ipKey, userKey) {
+		return
+	}
+
+	if !checkPassword(w, r, u, req.Password, ipKey, userKey) {
+		return
+	}
+
+	if err := verifySecondFactor(r.Context(), u, req.secondFactor); err != nil {
+		if err == errInvalidSecondFactor {
+			recordLoginFailure(r, ipKey, userKey)
+			http.Error(w, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Error verifying second factor: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := userStore.DisableTOTP(r.Context(), u.ID); err != nil {
+		log.Printf("Error disabling totp: %v", err)
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifySecondFactor checks a TOTP code, or failing that a recovery code,
+// for u. Accepted codes are burned so that they cannot be replayed. It
+// returns errInvalidSecondFactor if neither is valid.
+func verifySecondFactor(ctx context.Context, u *user.User, f secondFactor) error {
+	if f.Code != "" {
+		step, ok := totp.Validate(u.TOTPSecret, strings.TrimSpace(f.Code), time.Now(), totpSkew)
+		if !ok {
+			return errInvalidSecondFactor
+		}
+		err := userStore.UseTOTPStep(ctx, u.ID, step)
+		if err == user.ErrTOTPCodeReused {
+			return errInvalidSecondFactor
+		}
+		return err
+	}
+
+	if f.RecoveryCode != "" {
+		err := userStore.ConsumeRecoveryCode(ctx, u.ID, normalizeRecoveryCode(f.RecoveryCode))
+		if err == user.ErrRecoveryCodeInvalid {
+			return errInvalidSecondFactor
+		}
+		return err
+	}
+
+	return errInvalidSecondFactor
+}
+
+// generateRecoveryCodes returns a fresh set of single-use recovery codes,
+// formatted as XXXX-XXXX.
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := recoveryEncoding.EncodeToString(b)
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts recovery codes typed in lower case or
+// without the separator.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
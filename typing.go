@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/nexus-im/nexus/ratelimit"
+)
+
+const (
+	// typingTTL is how long a typing indicator lasts without a fresh
+	// typing_start, so that a client that crashes or disconnects mid-word
+	// does not leave it stuck. Clients repeat typing_start while the user
+	// keeps typing.
+	typingTTL = 6 * time.Second
+
+	// Typing events each connection may send: a burst of typingBurst, then
+	// typingRate per second.
+	typingRate  = 1
+	typingBurst = 5
+
+	typingLimiterKey = "typing"
+)
+
+type typingPayload struct {
+	ConversationID string `json:"conversation_id"`
+}
+
+// typingEventPayload is relayed to the other members of the conversation.
+type typingEventPayload struct {
+	ConversationID string `json:"conversation_id"`
+	UserID         string `json:"user_id"`
+}
+
+type typingKey struct {
+	conversationID string
+	userID         string
+}
+
+// typingTracker remembers who is typing in which conversation and expires
+// indicators that are not refreshed. It is safe for concurrent use; expiry
+// callbacks run on their own goroutine.
+type typingTracker struct {
+	mu     sync.Mutex
+	timers map[typingKey]*time.Timer
+}
+
+func newTypingTracker() *typingTracker {
+	return &typingTracker{timers: make(map[typingKey]*time.Timer)}
+}
+
+// start marks key as typing for ttl, calling onExpire if it is neither
+// refreshed nor stopped in time. It reports whether key was not typing
+// before, i.e. whether others need to be told.
+func (t *typingTracker) start(key typingKey, ttl time.Duration, onExpire func()) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if timer, ok := t.timers[key]; ok && timer.Stop() {
+		timer.Reset(ttl)
+		return false
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		t.mu.Lock()
+		current := t.timers[key] == timer
+		if current {
+			delete(t.timers, key)
+		}
+		t.mu.Unlock()
+
+		if current {
+			onExpire()
+		}
+	})
+	t.timers[key] = timer
+	return true
+}
+
+// stop clears key and reports whether it was typing.
+func (t *typingTracker) stop(key typingKey) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timer, ok := t.timers[key]
+	if !ok {
+		return false
+	}
+	timer.Stop()
+	delete(t.timers, key)
+	return true
+}
+
+func newTypingLimiter() ratelimit.Limiter {
+	return ratelimit.NewMemoryLimiter(ratelimit.Config{Rate: typingRate, Burst: typingBurst})
+}
+
+func handleTypingStart(ctx context.Context, c *Client, raw json.RawMessage) error {
+	return handleTyping(ctx, c, raw, true)
+}
+
+func handleTypingStop(ctx context.Context, c *Client, raw json.RawMessage) error {
+	return handleTyping(ctx, c, raw, false)
+}
+
+// handleTyping relays a change in c's typing state to the other members of
+// the conversation. Repeated typing_start events only extend the indicator.
+func handleTyping(ctx context.Context, c *Client, raw json.RawMessage, typing bool) error {
+	var p typingPayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return invalidPayload("malformed typing payload")
+	}
+	if p.ConversationID == "" {
+		return invalidPayload(errMissingConvo.Error())
+	}
+
+	wait, err := c.typingLimiter.Allow(ctx, typingLimiterKey)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return rateLimited("too many typing events")
+	}
+
+	members, err := conversationStore.ListMemberIDs(ctx, p.ConversationID)
+	if err != nil {
+		return err
+	}
+
+	others := make([]string, 0, len(members))
+	isMember := false
+	for _, id := range members {
+		if id == c.userID {
+			isMember = true
+			continue
+		}
+		others = append(others, id)
+	}
+	if !isMember {
+		return unauthorized("not a member of this conversation")
+	}
+
+	key := typingKey{conversationID: p.ConversationID, userID: c.userID}
+	event := typingEventPayload{ConversationID: p.ConversationID, UserID: c.userID}
+	hub := c.hub
+
+	if typing {
+		started := hub.typing.start(key, typingTTL, func() {
+			_ = hub.sendToUsers(others, eventTypingStop, event)
+		})
+		if !started {
+			return nil
+		}
+		return hub.sendToUsers(others, eventTypingStart, event)
+	}
+
+	if !hub.typing.stop(key) {
+		return nil
+	}
+	return hub.sendToUsers(others, eventTypingStop, event)
+}
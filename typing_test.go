@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTypingTrackerStartStop(t *testing.T) {
+	tr := newTypingTracker()
+	key := typingKey{conversationID: "convo-1", userID: "user-1"}
+	expired := make(chan struct{}, 1)
+	onExpire := func() { expired <- struct{}{} }
+
+	if !tr.start(key, time.Hour, onExpire) {
+		t.Error("first start should report a change")
+	}
+	if tr.start(key, time.Hour, onExpire) {
+		t.Error("repeated start should only refresh")
+	}
+	if !tr.stop(key) {
+		t.Error("stop after start should report a change")
+	}
+	if tr.stop(key) {
+		t.Error("second stop should report no change")
+	}
+	if !tr.start(key, time.Hour, onExpire) {
+		t.Error("start after stop should report a change")
+	}
+	tr.stop(key)
+
+	select {
+	case <-expired:
+		t.Error("stopped indicator must not expire")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestTypingTrackerExpiry(t *testing.T) {
+	tr := newTypingTracker()
+	key := typingKey{conversationID: "convo-1", userID: "user-1"}
+	expired := make(chan struct{}, 2)
+	onExpire := func() { expired <- struct{}{} }
+
+	// Refreshing replaces the remaining time with the new TTL.
+	tr.start(key, time.Hour, onExpire)
+	if tr.start(key, 10*time.Millisecond, onExpire) {
+		t.Error("refresh should report no change")
+	}
+
+	select {
+	case <-expired:
+	case <-time.After(time.Second):
+		t.Fatal("refreshed indicator did not expire")
+	}
+
+	if tr.stop(key) {
+		t.Error("expired indicator should already be cleared")
+	}
+	if !tr.start(key, time.Hour, onExpire) {
+		t.Error("start after expiry should report a change")
+	}
+	tr.stop(key)
+
+	select {
+	case <-expired:
+		t.Error("onExpire ran more than once")
+	case <-time.After(20 * time.Millisecond):
+	}
+}